@@ -3,8 +3,8 @@ module github.com/codigogp/letsgollm
 go 1.22.2
 
 require (
+	cloud.google.com/go/ai v0.8.0
 	github.com/PuerkitoBio/goquery v1.9.2
-	github.com/google/generative-ai-go v0.17.0
 	github.com/google/uuid v1.6.0
 	github.com/jdkato/prose/v2 v2.0.0
 	github.com/ledongthuc/pdf v0.0.0-20240201131950-da5b75280b06
@@ -12,11 +12,11 @@ require (
 	github.com/unidoc/unioffice v1.35.0
 	gonum.org/v1/gonum v0.15.0
 	google.golang.org/api v0.192.0
+	google.golang.org/protobuf v1.34.2
 )
 
 require (
 	cloud.google.com/go v0.115.0 // indirect
-	cloud.google.com/go/ai v0.8.0 // indirect
 	cloud.google.com/go/auth v0.8.1 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.3 // indirect
 	cloud.google.com/go/compute/metadata v0.5.0 // indirect
@@ -48,6 +48,5 @@ require (
 	google.golang.org/genproto/googleapis/api v0.0.0-20240711142825-46eb208f015d // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240730163845-b1a4ccb954bf // indirect
 	google.golang.org/grpc v1.64.1 // indirect
-	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/neurosnap/sentences.v1 v1.0.6 // indirect
 )
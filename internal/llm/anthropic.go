@@ -3,87 +3,494 @@ package llm
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
+const (
+	anthropicBaseURL          = "https://api.anthropic.com"
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 1024
+)
+
+// anthropicParams son los parámetros de generación que admite la API de Messages
+const anthropicParams = paramTopP | paramTopK | paramStopSequences
+
 type anthropicLLM struct {
-	apiKey string
-	config Config
+	apiKey  string
+	config  Config
+	client  *http.Client
+	baseURL string
 }
 
 func newAnthropic(cfg Config) (LLM, error) {
+	if err := checkParams(cfg, anthropicParams); err != nil {
+		return nil, err
+	}
+
+	baseURL := anthropicBaseURL
+	if cfg.BaseURL != "" {
+		baseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+
 	return &anthropicLLM{
-		apiKey: cfg.APIKey,
-		config: cfg,
+		apiKey:  cfg.APIKey,
+		config:  cfg,
+		client:  newHTTPClient(cfg.Transport, cfg.Headers, newRetryPolicy(cfg.MaxAttempts, cfg.MaxElapsedTime)),
+		baseURL: baseURL,
 	}, nil
 }
 
-func (a *anthropicLLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
-	url := "https://api.anthropic.com/v1/complete"
+// anthropicMessage es un mensaje en el formato de la API de Messages
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
 
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"model":                a.config.ModelName,
-		"prompt":               fmt.Sprintf("\n\nHuman: %s\n\nAssistant:", prompt),
-		"max_tokens_to_sample": a.config.MaxTokens,
-		"temperature":          a.config.Temperature,
-	})
+// anthropicTool es la declaración de una herramienta
+type anthropicTool struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	InputSchema *Schema `json:"input_schema"`
+}
+
+// anthropicRequest es el cuerpo de una petición a /v1/messages
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   float64            `json:"temperature"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	TopK          *int               `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+// anthropicContentBlock es un bloque de contenido: texto, imagen, petición de
+// herramienta (tool_use) o resultado de herramienta (tool_result)
+type anthropicContentBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+// anthropicImageSource es el contenido en base64 de un bloque de imagen
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// anthropicUsage es el consumo de tokens informado por la API
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicResponse es la respuesta de /v1/messages
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Role       string                  `json:"role"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+func (a *anthropicLLM) configuration() Config {
+	return a.config
+}
+
+func (a *anthropicLLM) GenerateResponse(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	model, err := a.withOptions(opts)
 	if err != nil {
-		return "", fmt.Errorf("error al crear el cuerpo de la solicitud: %w", err)
+		return "", err
 	}
+	return model.Chat(ctx, []Message{UserMessage(prompt)})
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
+// withOptions devuelve una copia que comparte el cliente pero usa la configuración con las opciones aplicadas
+func (a *anthropicLLM) withOptions(opts []Option) (*anthropicLLM, error) {
+	if len(opts) == 0 {
+		return a, nil
+	}
+	cfg := applyOptions(a.config, opts)
+	if err := checkParams(cfg, anthropicParams); err != nil {
+		return nil, err
+	}
+	model := *a
+	model.config = cfg
+	return &model, nil
+}
+
+func (a *anthropicLLM) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := a.complete(ctx, messages, nil)
 	if err != nil {
-		return "", fmt.Errorf("error al crear la solicitud: %w", err)
+		return "", err
 	}
+	return responseText(resp)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", a.apiKey)
+func (a *anthropicLLM) ChatResponse(ctx context.Context, messages []Message) (*Response, error) {
+	return a.complete(ctx, messages, nil)
+}
+
+func (a *anthropicLLM) ChatWithTools(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	return a.complete(ctx, messages, tools)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// complete envía la conversación y convierte los bloques de contenido en una Response
+func (a *anthropicLLM) complete(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	if err := validateMessages(messages); err != nil {
+		return nil, err
+	}
+
+	req, err := a.messagesRequest(ctx, messages, false)
 	if err != nil {
-		return "", fmt.Errorf("error al hacer la solicitud: %w", err)
+		return nil, err
+	}
+	for _, tool := range tools {
+		schema := tool.Parameters
+		if schema == nil {
+			schema = &Schema{Type: SchemaObject}
+		}
+		req.Tools = append(req.Tools, anthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	start := time.Now()
+	resp, err := a.send(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("error al leer la respuesta: %w", err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error en la respuesta de Anthropic: %s", string(body))
+	var result anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error al decodificar la respuesta: %w", err)
 	}
 
-	var result struct {
-		Completion string `json:"completion"`
+	response := &Response{
+		FinishReason: anthropicFinishReason(result.StopReason),
+		Model:        result.Model,
+		Usage: Usage{
+			PromptTokens:     result.Usage.InputTokens,
+			CompletionTokens: result.Usage.OutputTokens,
+		},
 	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("error al decodificar la respuesta: %w", err)
+	var text strings.Builder
+	for _, block := range result.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			response.ToolCalls = append(response.ToolCalls, ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			})
+		}
 	}
+	response.Content = text.String()
 
-	return result.Completion, nil
+	return finishResponse(response, a.config, start), nil
 }
 
-func (a *anthropicLLM) GenerateResponseAsync(ctx context.Context, prompt string) (<-chan string, <-chan error) {
-	respChan := make(chan string)
-	errChan := make(chan error)
+func (a *anthropicLLM) StreamChat(ctx context.Context, messages []Message) <-chan StreamEvent {
+	if err := validateMessages(messages); err != nil {
+		return errorStream(err)
+	}
+
+	req, err := a.messagesRequest(ctx, messages, true)
+	if err != nil {
+		return errorStream(err)
+	}
+
+	resp, err := a.send(ctx, req)
+	if err != nil {
+		return errorStream(err)
+	}
+
+	events := make(chan StreamEvent)
 
 	go func() {
-		defer close(respChan)
-		defer close(errChan)
+		defer close(events)
+		defer resp.Body.Close()
 
-		resp, err := a.GenerateResponse(ctx, prompt)
-		if err != nil {
-			errChan <- err
-			return
+		final := StreamEvent{Done: true, Usage: &Usage{}}
+		reader := newSSEReader(resp.Body)
+		for {
+			event, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("error al leer el streaming de Anthropic: %w", err)})
+				return
+			}
+
+			var data struct {
+				Message struct {
+					Usage anthropicUsage `json:"usage"`
+				} `json:"message"`
+				Delta struct {
+					Type       string `json:"type"`
+					Text       string `json:"text"`
+					StopReason string `json:"stop_reason"`
+				} `json:"delta"`
+				Usage anthropicUsage `json:"usage"`
+				Error struct {
+					Type    string `json:"type"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if event.Data != "" {
+				if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
+					sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("error al decodificar el evento %s: %w", event.Name, err)})
+					return
+				}
+			}
+
+			switch event.Name {
+			case "message_start":
+				final.Usage.PromptTokens = data.Message.Usage.InputTokens
+			case "content_block_delta":
+				if data.Delta.Type == "text_delta" && data.Delta.Text != "" {
+					if !sendEvent(ctx, events, StreamEvent{Delta: data.Delta.Text}) {
+						return
+					}
+				}
+			case "message_delta":
+				if data.Delta.StopReason != "" {
+					final.FinishReason = anthropicFinishReason(data.Delta.StopReason)
+				}
+				final.Usage.CompletionTokens = data.Usage.OutputTokens
+			case "error":
+				sendEvent(ctx, events, StreamEvent{Done: true, Err: newAnthropicError(0, data.Error.Type, data.Error.Message, []byte(event.Data))})
+				return
+			}
 		}
 
-		respChan <- resp
+		final.Usage.TotalTokens = final.Usage.PromptTokens + final.Usage.CompletionTokens
+		sendEvent(ctx, events, final)
 	}()
 
-	return respChan, errChan
+	return events
+}
+
+func (a *anthropicLLM) GenerateResponseAsync(ctx context.Context, prompt string, opts ...Option) (<-chan string, <-chan error) {
+	model, err := a.withOptions(opts)
+	if err != nil {
+		return streamToAsync(ctx, errorStream(err))
+	}
+	return streamToAsync(ctx, model.StreamChat(ctx, []Message{UserMessage(prompt)}))
+}
+
+// messagesRequest construye la petición separando las instrucciones de sistema del resto de turnos
+func (a *anthropicLLM) messagesRequest(ctx context.Context, messages []Message, stream bool) (anthropicRequest, error) {
+	req := anthropicRequest{
+		Model:       a.config.ModelName,
+		MaxTokens:   a.config.MaxTokens,
+		Temperature: a.config.Temperature,
+		Stream:      stream,
+	}
+	if a.config.TopP != 0 {
+		req.TopP = &a.config.TopP
+	}
+	if a.config.TopK != 0 {
+		req.TopK = &a.config.TopK
+	}
+	req.StopSequences = a.config.StopSequences
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	var system []string
+	for i, msg := range messages {
+		if msg.Role == RoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		// Anthropic asocia cada tool_result a su tool_use por el ID, el nombre no basta
+		if msg.Role == RoleTool && msg.ToolCallID == "" {
+			return anthropicRequest{}, fmt.Errorf("el mensaje %d de herramienta no indica el ID de la llamada a la que responde", i)
+		}
+
+		role, blocks := anthropicBlocks(msg)
+		if len(msg.Images) > 0 {
+			images, err := anthropicImageBlocks(ctx, a.config.Transport, msg.Images)
+			if err != nil {
+				return anthropicRequest{}, err
+			}
+			// Anthropic recomienda enviar las imágenes antes del texto que se refiere a ellas
+			blocks = append(images, blocks...)
+		}
+		// La API rechaza los mensajes sin contenido, así que se omiten
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// Los resultados de herramientas consecutivos deben viajar en un único mensaje del usuario
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, blocks...)
+			continue
+		}
+		req.Messages = append(req.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	req.System = strings.Join(system, "\n\n")
+
+	return req, nil
+}
+
+// anthropicBlocks convierte un mensaje en el rol y los bloques de contenido de la API
+func anthropicBlocks(msg Message) (string, []anthropicContentBlock) {
+	switch msg.Role {
+	case RoleTool:
+		return "user", []anthropicContentBlock{{
+			Type:      "tool_result",
+			ToolUseID: msg.ToolCallID,
+			Content:   msg.Content,
+		}}
+	case RoleAssistant:
+		var blocks []anthropicContentBlock
+		if msg.Content != "" {
+			blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+		}
+		for _, call := range msg.ToolCalls {
+			input := json.RawMessage(call.Arguments)
+			if len(input) == 0 {
+				input = json.RawMessage("{}")
+			}
+			blocks = append(blocks, anthropicContentBlock{
+				Type:  "tool_use",
+				ID:    call.ID,
+				Name:  call.Name,
+				Input: input,
+			})
+		}
+		return "assistant", blocks
+	default:
+		// La API rechaza los bloques de texto vacíos
+		if msg.Content == "" {
+			return "user", nil
+		}
+		return "user", []anthropicContentBlock{{Type: "text", Text: msg.Content}}
+	}
+}
+
+// anthropicImageBlocks convierte las imágenes en bloques con su contenido en base64
+func anthropicImageBlocks(ctx context.Context, transport http.RoundTripper, images []Image) ([]anthropicContentBlock, error) {
+	blocks := make([]anthropicContentBlock, 0, len(images))
+	for _, img := range images {
+		data, mimeType, err := img.load(ctx, transport)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, anthropicContentBlock{
+			Type: "image",
+			Source: &anthropicImageSource{
+				Type:      "base64",
+				MediaType: mimeType,
+				Data:      base64.StdEncoding.EncodeToString(data),
+			},
+		})
+	}
+	return blocks, nil
+}
+
+// send realiza la petición a la API y devuelve la respuesta si el código de estado es correcto
+func (a *anthropicLLM) send(ctx context.Context, body anthropicRequest) (*http.Response, error) {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el cuerpo de la solicitud: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/v1/messages", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error al crear la solicitud: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	if body.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al hacer la solicitud: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, decodeAnthropicError(resp)
+	}
+
+	return resp, nil
+}
+
+// decodeAnthropicError interpreta el cuerpo de error de la API
+func decodeAnthropicError(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error al leer la respuesta: %w", err)
+	}
+
+	var payload struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &payload)
+	return newAnthropicError(resp.StatusCode, payload.Error.Type, payload.Error.Message, body)
+}
+
+// newAnthropicError clasifica un error de Anthropic por su tipo, que también llega en los eventos de error del streaming
+func newAnthropicError(status int, errType, message string, body []byte) *APIError {
+	apiErr := newHTTPAPIError(Anthropic, status, errType, message, body)
+	switch errType {
+	case "authentication_error", "permission_error":
+		apiErr.Kind = ErrAuth
+	case "rate_limit_error":
+		apiErr.Kind = refineKind(ErrRateLimited, errType, message)
+	case "overloaded_error", "api_error":
+		apiErr.Kind = ErrUnavailable
+	case "invalid_request_error", "not_found_error", "request_too_large":
+		if apiErr.Kind == nil {
+			apiErr.Kind = refineKind(ErrInvalidRequest, errType, message)
+		}
+	}
+	return apiErr
+}
+
+// anthropicFinishReason traduce el motivo de parada de Anthropic al formato común
+func anthropicFinishReason(reason string) FinishReason {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return FinishReasonStop
+	case "max_tokens":
+		return FinishReasonLength
+	case "tool_use":
+		return FinishReasonToolCalls
+	default:
+		return FinishReasonOther
+	}
 }
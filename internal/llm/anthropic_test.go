@@ -0,0 +1,252 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// anthropicServer levanta un servidor que guarda el cuerpo de cada petición
+// y responde con el código de estado, tipo de contenido y cuerpo indicados
+func anthropicServer(t *testing.T, status int, contentType, body string) (LLM, *anthropicRequest) {
+	t.Helper()
+	var got anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("ruta inesperada: %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("cabeceras incorrectas: %v", r.Header)
+		}
+		raw, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Errorf("cuerpo no válido: %v", err)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	model, err := New(Config{Provider: Anthropic, ModelName: "claude-3-5-sonnet-20240620", APIKey: "test-key", BaseURL: server.URL, MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model, &got
+}
+
+// sseBody construye un flujo Server-Sent Events con pares de nombre y datos
+func sseBody(events ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(events); i += 2 {
+		fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", events[i], events[i+1])
+	}
+	return b.String()
+}
+
+func TestAnthropicChatShapesMessages(t *testing.T) {
+	model, got := anthropicServer(t, http.StatusOK, "application/json", `{
+		"id": "msg_1", "model": "claude-3-5-sonnet-20240620", "role": "assistant",
+		"content": [{"type": "text", "text": "Hola, "}, {"type": "text", "text": "¿qué tal?"}],
+		"stop_reason": "end_turn", "usage": {"input_tokens": 12, "output_tokens": 5}
+	}`)
+
+	resp, err := model.ChatResponse(context.Background(), []Message{
+		SystemMessage("Eres conciso."),
+		UserMessage("Hola"),
+		AssistantMessage("Hola."),
+		SystemMessage("Responde en español."),
+		UserMessage("¿Cómo estás?"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.System != "Eres conciso.\n\nResponde en español." {
+		t.Errorf("system inesperado: %q", got.System)
+	}
+	if got.MaxTokens != anthropicDefaultMaxTokens || got.Stream {
+		t.Errorf("max_tokens o stream inesperados: %d %v", got.MaxTokens, got.Stream)
+	}
+	roles := []string{"user", "assistant", "user"}
+	if len(got.Messages) != len(roles) {
+		t.Fatalf("se esperaban %d mensajes, hay %d", len(roles), len(got.Messages))
+	}
+	for i, msg := range got.Messages {
+		if msg.Role != roles[i] {
+			t.Errorf("mensaje %d: rol %s, se esperaba %s", i, msg.Role, roles[i])
+		}
+	}
+
+	if resp.Content != "Hola, ¿qué tal?" || resp.FinishReason != FinishReasonStop {
+		t.Errorf("respuesta inesperada: %+v", resp)
+	}
+	if resp.Usage != (Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}) {
+		t.Errorf("consumo inesperado: %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicToolUseAndResult(t *testing.T) {
+	model, got := anthropicServer(t, http.StatusOK, "application/json", `{
+		"model": "claude-3-5-sonnet-20240620", "role": "assistant",
+		"content": [
+			{"type": "text", "text": "Consulto el tiempo."},
+			{"type": "tool_use", "id": "toolu_2", "name": "clima", "input": {"ciudad":"Lima"}}
+		],
+		"stop_reason": "tool_use", "usage": {"input_tokens": 30, "output_tokens": 20}
+	}`)
+
+	tools := []Tool{{Name: "clima", Description: "Tiempo actual", Parameters: &Schema{Type: SchemaObject}}}
+	resp, err := model.ChatWithTools(context.Background(), []Message{
+		UserMessage("¿Qué tiempo hace en Madrid y en Lima?"),
+		{Role: RoleAssistant, ToolCalls: []ToolCall{
+			{ID: "toolu_0", Name: "clima", Arguments: `{"ciudad":"Madrid"}`},
+			{ID: "toolu_1", Name: "clima"},
+		}},
+		{Role: RoleTool, ToolCallID: "toolu_0", Name: "clima", Content: "soleado"},
+		{Role: RoleTool, ToolCallID: "toolu_1", Name: "clima", Content: "nublado"},
+	}, tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Tools) != 1 || got.Tools[0].Name != "clima" || got.Tools[0].InputSchema == nil {
+		t.Errorf("herramientas inesperadas: %+v", got.Tools)
+	}
+	if len(got.Messages) != 3 {
+		t.Fatalf("se esperaban 3 mensajes, hay %d", len(got.Messages))
+	}
+	uses := got.Messages[1].Content
+	if len(uses) != 2 || uses[0].Type != "tool_use" || uses[0].ID != "toolu_0" || string(uses[0].Input) != `{"ciudad":"Madrid"}` {
+		t.Errorf("bloques tool_use inesperados: %+v", uses)
+	}
+	if string(uses[1].Input) != "{}" {
+		t.Errorf("una llamada sin argumentos debe enviar un objeto vacío, se envió %s", uses[1].Input)
+	}
+	results := got.Messages[2].Content
+	if got.Messages[2].Role != "user" || len(results) != 2 {
+		t.Fatalf("los resultados deben viajar juntos en un mensaje del usuario: %+v", got.Messages[2])
+	}
+	if results[0].Type != "tool_result" || results[0].ToolUseID != "toolu_0" || results[1].ToolUseID != "toolu_1" || results[1].Content != "nublado" {
+		t.Errorf("bloques tool_result inesperados: %+v", results)
+	}
+
+	if resp.FinishReason != FinishReasonToolCalls || resp.Content != "Consulto el tiempo." {
+		t.Errorf("respuesta inesperada: %+v", resp)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0] != (ToolCall{ID: "toolu_2", Name: "clima", Arguments: `{"ciudad":"Lima"}`}) {
+		t.Errorf("llamadas inesperadas: %+v", resp.ToolCalls)
+	}
+}
+
+func TestAnthropicStreamChat(t *testing.T) {
+	model, got := anthropicServer(t, http.StatusOK, "text/event-stream", ": ping\n\n"+sseBody(
+		"message_start", `{"type":"message_start","message":{"usage":{"input_tokens":9,"output_tokens":1}}}`,
+		"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hola"}}`,
+		"ping", `{"type":"ping"}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" mundo"}}`,
+		"content_block_stop", `{"type":"content_block_stop","index":0}`,
+		"message_delta", `{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":4}}`,
+		"message_stop", `{"type":"message_stop"}`,
+	))
+
+	var deltas []string
+	var last StreamEvent
+	for event := range model.StreamChat(context.Background(), []Message{UserMessage("Hola")}) {
+		if event.Done {
+			last = event
+			continue
+		}
+		deltas = append(deltas, event.Delta)
+	}
+
+	if !got.Stream {
+		t.Error("la petición no pide streaming")
+	}
+	if strings.Join(deltas, "|") != "Hola| mundo" {
+		t.Errorf("fragmentos inesperados: %q", deltas)
+	}
+	if last.Err != nil || last.FinishReason != FinishReasonLength {
+		t.Errorf("evento final inesperado: %+v", last)
+	}
+	if last.Usage == nil || *last.Usage != (Usage{PromptTokens: 9, CompletionTokens: 4, TotalTokens: 13}) {
+		t.Errorf("consumo inesperado: %+v", last.Usage)
+	}
+}
+
+func TestAnthropicStreamErrorEvent(t *testing.T) {
+	model, _ := anthropicServer(t, http.StatusOK, "text/event-stream", sseBody(
+		"message_start", `{"type":"message_start","message":{"usage":{"input_tokens":9}}}`,
+		"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Ho"}}`,
+		"error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	))
+
+	var last StreamEvent
+	for event := range model.StreamChat(context.Background(), []Message{UserMessage("Hola")}) {
+		last = event
+	}
+
+	if !last.Done || !errors.Is(last.Err, ErrUnavailable) {
+		t.Fatalf("se esperaba ErrUnavailable, se obtuvo %+v", last)
+	}
+	var apiErr *APIError
+	if !errors.As(last.Err, &apiErr) || apiErr.Code != "overloaded_error" || apiErr.Message != "Overloaded" {
+		t.Errorf("error inesperado: %v", last.Err)
+	}
+}
+
+func TestAnthropicErrorResponse(t *testing.T) {
+	model, _ := anthropicServer(t, http.StatusUnauthorized, "application/json",
+		`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+
+	_, err := model.Chat(context.Background(), []Message{UserMessage("Hola")})
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("se esperaba ErrAuth, se obtuvo %v", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Provider != Anthropic {
+		t.Errorf("error inesperado: %+v", apiErr)
+	}
+}
+
+func TestAnthropicRequestDropsEmptyText(t *testing.T) {
+	a := &anthropicLLM{config: Config{ModelName: "claude-3-5-sonnet"}}
+	req, err := a.messagesRequest(context.Background(), []Message{
+		UserMessage(""),
+		UserMessage("Hola"),
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "toolu_1", Name: "clima"}}},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(req.Messages) != 2 {
+		t.Fatalf("se esperaban 2 mensajes, hay %d", len(req.Messages))
+	}
+	for _, msg := range req.Messages {
+		for _, block := range msg.Content {
+			if block.Type == "text" && block.Text == "" {
+				t.Errorf("el mensaje %s contiene un bloque de texto vacío", msg.Role)
+			}
+		}
+	}
+}
+
+func TestAnthropicRequestRequiresToolCallID(t *testing.T) {
+	a := &anthropicLLM{config: Config{ModelName: "claude-3-5-sonnet"}}
+	_, err := a.messagesRequest(context.Background(), []Message{
+		UserMessage("¿Qué tiempo hace?"),
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "toolu_1", Name: "clima"}}},
+		{Role: RoleTool, Name: "clima", Content: "soleado"},
+	}, false)
+	if err == nil {
+		t.Fatal("se esperaba un error por la falta de tool_use_id")
+	}
+}
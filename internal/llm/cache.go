@@ -0,0 +1,449 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheEntry es una respuesta almacenada en caché. Un ExpiresAt cero indica
+// que la entrada no caduca.
+type CacheEntry struct {
+	Response  Response  `json:"response"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e CacheEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// Cache almacena respuestas por clave. Get no devuelve entradas caducadas.
+type Cache interface {
+	Get(key string) (CacheEntry, bool, error)
+	Set(key string, entry CacheEntry) error
+}
+
+// configured lo implementan los proveedores para exponer su configuración,
+// que forma parte de la clave de caché
+type configured interface {
+	configuration() Config
+}
+
+type bypassCacheKey struct{}
+
+// BypassCache devuelve un contexto con el que las llamadas ignoran las
+// respuestas en caché; el resultado nuevo sí se guarda
+func BypassCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+// CachedLLM envuelve un LLM y reutiliza las respuestas de peticiones idénticas.
+// La clave combina proveedor, modelo, parámetros de generación, mensajes y
+// herramientas. TTL cero guarda las respuestas sin caducidad y Bypass hace que
+// se ignore la caché al leer, igual que BypassCache para una sola llamada.
+// Un error al guardar una respuesta no hace fallar la llamada; OnStoreError,
+// si no es nil, lo recibe.
+// KeyPrefix se añade a la clave y es obligatorio cuando LLM no es uno de los
+// proveedores del paquete (un Router o una implementación propia), porque
+// entonces no se conoce el modelo que responde.
+type CachedLLM struct {
+	LLM          LLM
+	Cache        Cache
+	TTL          time.Duration
+	Bypass       bool
+	KeyPrefix    string
+	OnStoreError func(error)
+}
+
+// NewCachedLLM crea un CachedLLM sobre el modelo y la caché indicados
+func NewCachedLLM(model LLM, cache Cache, ttl time.Duration) *CachedLLM {
+	return &CachedLLM{LLM: model, Cache: cache, TTL: ttl}
+}
+
+func (c *CachedLLM) GenerateResponse(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	if len(opts) == 0 {
+		return c.Chat(ctx, []Message{UserMessage(prompt)})
+	}
+
+	resp, err := c.cached(ctx, []Message{UserMessage(prompt)}, nil, opts, func() (*Response, error) {
+		content, err := c.LLM.GenerateResponse(ctx, prompt, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Content: content}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+func (c *CachedLLM) GenerateResponseAsync(ctx context.Context, prompt string, opts ...Option) (<-chan string, <-chan error) {
+	messages := []Message{UserMessage(prompt)}
+	return streamToAsync(ctx, c.stream(ctx, messages, opts, func() <-chan StreamEvent {
+		if len(opts) == 0 {
+			return c.LLM.StreamChat(ctx, messages)
+		}
+		respChan, errChan := c.LLM.GenerateResponseAsync(ctx, prompt, opts...)
+		return asyncToStream(ctx, respChan, errChan)
+	}))
+}
+
+func (c *CachedLLM) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := c.ChatResponse(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	return responseText(resp)
+}
+
+func (c *CachedLLM) ChatResponse(ctx context.Context, messages []Message) (*Response, error) {
+	return c.cached(ctx, messages, nil, nil, func() (*Response, error) {
+		return c.LLM.ChatResponse(ctx, messages)
+	})
+}
+
+func (c *CachedLLM) ChatWithTools(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	return c.cached(ctx, messages, tools, nil, func() (*Response, error) {
+		return c.LLM.ChatWithTools(ctx, messages, tools)
+	})
+}
+
+// StreamChat reproduce una respuesta en caché como un único fragmento; si no
+// la hay, reenvía el stream del modelo y guarda el resultado al terminar
+func (c *CachedLLM) StreamChat(ctx context.Context, messages []Message) <-chan StreamEvent {
+	return c.stream(ctx, messages, nil, func() <-chan StreamEvent {
+		return c.LLM.StreamChat(ctx, messages)
+	})
+}
+
+func (c *CachedLLM) stream(ctx context.Context, messages []Message, opts []Option, open func() <-chan StreamEvent) <-chan StreamEvent {
+	key, err := c.key(messages, nil, opts)
+	if err != nil {
+		return errorStream(err)
+	}
+
+	if resp, ok, err := c.lookup(ctx, key, time.Now()); err != nil {
+		return errorStream(err)
+	} else if ok {
+		events := make(chan StreamEvent, 2)
+		events <- StreamEvent{Delta: resp.Content}
+		events <- StreamEvent{Done: true, FinishReason: resp.FinishReason, Usage: &resp.Usage}
+		close(events)
+		return events
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+
+		start := time.Now()
+		var content strings.Builder
+		for event := range open() {
+			content.WriteString(event.Delta)
+			if event.Done && event.Err == nil {
+				resp := &Response{Content: content.String(), FinishReason: event.FinishReason, Latency: time.Since(start)}
+				if event.Usage != nil {
+					resp.Usage = *event.Usage
+				}
+				c.store(key, resp)
+			}
+			if !sendEvent(ctx, events, event) {
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// cached devuelve la respuesta guardada para la petición o llama a generate y la guarda
+func (c *CachedLLM) cached(ctx context.Context, messages []Message, tools []Tool, opts []Option, generate func() (*Response, error)) (*Response, error) {
+	key, err := c.key(messages, tools, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if resp, ok, err := c.lookup(ctx, key, start); err != nil {
+		return nil, err
+	} else if ok {
+		resp.Latency = time.Since(start)
+		return resp, nil
+	}
+
+	resp, err := generate()
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, resp)
+	return resp, nil
+}
+
+// lookup busca la clave en la caché salvo que se haya pedido ignorarla. Las
+// respuestas recuperadas se marcan como Cached y no tienen coste.
+func (c *CachedLLM) lookup(ctx context.Context, key string, now time.Time) (*Response, bool, error) {
+	if c.Bypass || ctx.Value(bypassCacheKey{}) != nil {
+		return nil, false, nil
+	}
+
+	entry, ok, err := c.Cache.Get(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("error leyendo la caché: %w", err)
+	}
+	if !ok || entry.expired(now) {
+		return nil, false, nil
+	}
+
+	resp := entry.Response
+	resp.Cached = true
+	resp.Cost = 0
+	return &resp, true, nil
+}
+
+// store guarda la respuesta. La respuesta ya se ha generado (y pagado), así
+// que un error de la caché solo se notifica a OnStoreError.
+func (c *CachedLLM) store(key string, resp *Response) {
+	entry := CacheEntry{Response: *resp}
+	if c.TTL > 0 {
+		entry.ExpiresAt = time.Now().Add(c.TTL)
+	}
+	if err := c.Cache.Set(key, entry); err != nil && c.OnStoreError != nil {
+		c.OnStoreError(fmt.Errorf("error escribiendo en la caché: %w", err))
+	}
+}
+
+// key calcula la clave de caché de una petición como un hash SHA-256 de sus
+// parámetros, incluidas las opciones de la llamada
+func (c *CachedLLM) key(messages []Message, tools []Tool, opts []Option) (string, error) {
+	messages, err := keyMessages(messages)
+	if err != nil {
+		return "", err
+	}
+
+	var cfg Config
+	var provider string
+	if model, ok := c.LLM.(configured); ok {
+		cfg = model.configuration()
+		provider = cfg.Provider.String()
+	} else if c.KeyPrefix == "" {
+		return "", fmt.Errorf("no se conoce el modelo de %T: indica KeyPrefix para identificarlo en la clave de caché", c.LLM)
+	}
+	cfg = applyOptions(cfg, opts)
+
+	request := struct {
+		Prefix           string          `json:"prefix,omitempty"`
+		Provider         string          `json:"provider"`
+		Model            string          `json:"model"`
+		BaseURL          string          `json:"base_url,omitempty"`
+		Temperature      float64         `json:"temperature"`
+		MaxTokens        int             `json:"max_tokens"`
+		TopP             float64         `json:"top_p,omitempty"`
+		TopK             int             `json:"top_k,omitempty"`
+		StopSequences    []string        `json:"stop_sequences,omitempty"`
+		PresencePenalty  float64         `json:"presence_penalty,omitempty"`
+		FrequencyPenalty float64         `json:"frequency_penalty,omitempty"`
+		Seed             *int            `json:"seed,omitempty"`
+		CandidateCount   int             `json:"candidate_count,omitempty"`
+		SafetySettings   []SafetySetting `json:"safety_settings,omitempty"`
+		Messages         []Message       `json:"messages"`
+		Tools            []Tool          `json:"tools,omitempty"`
+	}{
+		Prefix:           c.KeyPrefix,
+		Provider:         provider,
+		Model:            cfg.ModelName,
+		BaseURL:          cfg.BaseURL,
+		Temperature:      cfg.Temperature,
+		MaxTokens:        cfg.MaxTokens,
+		TopP:             cfg.TopP,
+		TopK:             cfg.TopK,
+		StopSequences:    cfg.StopSequences,
+		PresencePenalty:  cfg.PresencePenalty,
+		FrequencyPenalty: cfg.FrequencyPenalty,
+		Seed:             cfg.Seed,
+		CandidateCount:   cfg.CandidateCount,
+		SafetySettings:   cfg.SafetySettings,
+		Messages:         messages,
+		Tools:            tools,
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("error al calcular la clave de caché: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// keyMessages sustituye la ruta de las imágenes por el hash de su contenido,
+// para que un archivo modificado no reutilice la respuesta anterior
+func keyMessages(messages []Message) ([]Message, error) {
+	var keyed []Message
+	for i, msg := range messages {
+		var images []Image
+		for j, img := range msg.Images {
+			if img.Path == "" {
+				continue
+			}
+			data, err := os.ReadFile(img.Path)
+			if err != nil {
+				return nil, fmt.Errorf("error al leer la imagen: %w", err)
+			}
+			if images == nil {
+				images = append([]Image(nil), msg.Images...)
+			}
+			sum := sha256.Sum256(data)
+			images[j] = Image{Data: sum[:], MIMEType: img.MIMEType}
+		}
+		if images == nil {
+			continue
+		}
+		if keyed == nil {
+			keyed = append([]Message(nil), messages...)
+		}
+		keyed[i].Images = images
+	}
+	if keyed == nil {
+		return messages, nil
+	}
+	return keyed, nil
+}
+
+// MemoryCache es una caché en memoria que descarta las entradas menos usadas
+// recientemente al superar su capacidad. Es segura para uso concurrente.
+type MemoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry CacheEntry
+}
+
+// NewMemoryCache crea una caché LRU con la capacidad indicada (sin límite si es 0)
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (m *MemoryCache) Get(key string) (CacheEntry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.items[key]
+	if !ok {
+		return CacheEntry{}, false, nil
+	}
+	item := elem.Value.(*memoryCacheItem)
+	if item.entry.expired(time.Now()) {
+		m.order.Remove(elem)
+		delete(m.items, key)
+		return CacheEntry{}, false, nil
+	}
+
+	m.order.MoveToFront(elem)
+	return item.entry, true, nil
+}
+
+func (m *MemoryCache) Set(key string, entry CacheEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.items[key]; ok {
+		elem.Value.(*memoryCacheItem).entry = entry
+		m.order.MoveToFront(elem)
+		return nil
+	}
+
+	m.items[key] = m.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	if m.capacity > 0 && m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+// Len devuelve el número de entradas en la caché
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// DiskCache guarda cada respuesta como un archivo JSON dentro de un directorio,
+// de modo que la caché se conserva entre ejecuciones
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache crea una caché en disco en el directorio indicado, creándolo si no existe
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error al crear el directorio de caché: %w", err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (d *DiskCache) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
+
+func (d *DiskCache) Get(key string) (CacheEntry, bool, error) {
+	data, err := os.ReadFile(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return CacheEntry{}, false, nil
+	}
+	if err != nil {
+		return CacheEntry{}, false, err
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		// Un archivo corrupto se trata como un fallo de caché y se sobrescribirá
+		return CacheEntry{}, false, nil
+	}
+	if entry.expired(time.Now()) {
+		os.Remove(d.path(key))
+		return CacheEntry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+func (d *DiskCache) Set(key string, entry CacheEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Se escribe en un archivo temporal y se renombra para no dejar entradas a medias
+	tmp, err := os.CreateTemp(d.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path(key))
+}
@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingCache no encuentra nada y falla al guardar
+type failingCache struct{}
+
+func (failingCache) Get(key string) (CacheEntry, bool, error) { return CacheEntry{}, false, nil }
+
+func (failingCache) Set(key string, entry CacheEntry) error { return errors.New("disco lleno") }
+
+func TestCachedLLMIgnoresStoreErrors(t *testing.T) {
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{{Content: "Hola", Repeat: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var storeErrs []error
+	cached := NewCachedLLM(mock, failingCache{}, 0)
+	cached.OnStoreError = func(err error) { storeErrs = append(storeErrs, err) }
+
+	resp, err := cached.ChatResponse(context.Background(), []Message{UserMessage("Hola")})
+	if err != nil || resp.Content != "Hola" {
+		t.Fatalf("la respuesta debe llegar aunque falle la caché: %v, %+v", err, resp)
+	}
+
+	var last StreamEvent
+	for event := range cached.StreamChat(context.Background(), []Message{UserMessage("Hola")}) {
+		last = event
+	}
+	if !last.Done || last.Err != nil {
+		t.Fatalf("el stream debe terminar sin error: %+v", last)
+	}
+
+	if len(storeErrs) != 2 {
+		t.Errorf("se esperaban 2 errores notificados, hubo %v", storeErrs)
+	}
+}
+
+func TestCachedLLMKeyHashesImageContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foto.png")
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\nprimera"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{{Content: "Un gato"}, {Content: "Un perro"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := NewCachedLLM(mock, NewMemoryCache(0), 0)
+	messages := []Message{UserMessageWithImages("¿Qué hay en la foto?", ImageFile(path))}
+
+	first, err := cached.Chat(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := cached.Chat(context.Background(), messages)
+	if err != nil || again != first {
+		t.Fatalf("la misma imagen debe servirse desde la caché: %q, %v", again, err)
+	}
+
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\nsegunda"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := cached.Chat(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != "Un perro" {
+		t.Errorf("una imagen modificada no debe reutilizar la respuesta anterior: %q", changed)
+	}
+	if messages[0].Images[0].Path != path {
+		t.Error("la clave no debe modificar los mensajes del llamador")
+	}
+}
+
+func TestCachedLLMRequiresKeyPrefixForUnknownModels(t *testing.T) {
+	newRouter := func(content string) *Router {
+		mock, err := NewMock(MockConfig{Responses: []MockResponse{{Content: content, Repeat: true}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		router, err := NewRouter(RouteFallback, Backend{LLM: mock})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return router
+	}
+	cache := NewMemoryCache(0)
+	messages := []Message{UserMessage("Hola")}
+
+	if _, err := NewCachedLLM(newRouter("Hola"), cache, 0).Chat(context.Background(), messages); err == nil {
+		t.Fatal("sin KeyPrefix no se puede identificar el modelo de un Router")
+	}
+
+	first := NewCachedLLM(newRouter("Hola desde el primero"), cache, 0)
+	first.KeyPrefix = "primero"
+	second := NewCachedLLM(newRouter("Hola desde el segundo"), cache, 0)
+	second.KeyPrefix = "segundo"
+
+	if _, err := first.Chat(context.Background(), messages); err != nil {
+		t.Fatal(err)
+	}
+	content, err := second.Chat(context.Background(), messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Hola desde el segundo" {
+		t.Errorf("modelos con distinto KeyPrefix no deben compartir respuestas: %q", content)
+	}
+}
@@ -0,0 +1,271 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gl "cloud.google.com/go/ai/generativelanguage/apiv1beta"
+	pb "cloud.google.com/go/ai/generativelanguage/apiv1beta/generativelanguagepb"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	openAIEmbeddingBatchSize = 2048
+	geminiEmbeddingBatchSize = 100
+)
+
+// Embedder genera embeddings para una lista de textos. Dimensions devuelve el
+// tamaño de los vectores generados, o 0 si aún no se conoce.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+	Dimensions() int
+}
+
+// EmbedderConfig contiene la configuración para crear un Embedder
+type EmbedderConfig struct {
+	Provider       Provider
+	ModelName      string
+	APIKey         string
+	Dimensions     int
+	BatchSize      int
+	BaseURL        string
+	Headers        map[string]string
+	Organization   string
+	MaxAttempts    int
+	MaxElapsedTime time.Duration
+	Transport      http.RoundTripper
+}
+
+// knownEmbeddingDimensions recoge el tamaño por defecto de los modelos más habituales
+var knownEmbeddingDimensions = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+	"text-embedding-ada-002": 1536,
+	"text-embedding-004":     768,
+	"embedding-001":          768,
+}
+
+// NewEmbedder crea un Embedder basado en la configuración proporcionada
+func NewEmbedder(cfg EmbedderConfig) (Embedder, error) {
+	switch cfg.Provider {
+	case OpenAI:
+		return newOpenAIEmbedder(cfg)
+	case Gemini:
+		return newGeminiEmbedder(cfg)
+	case Ollama:
+		return newOllamaEmbedder(cfg)
+	case OpenAICompatible:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("el proveedor compatible con OpenAI requiere BaseURL")
+		}
+		return newOpenAIEmbedder(cfg)
+	default:
+		return nil, fmt.Errorf("proveedor de embeddings no soportado: %v", cfg.Provider)
+	}
+}
+
+// embedderDimensions guarda el tamaño de los vectores, conocido de antemano o
+// deducido de la primera respuesta
+type embedderDimensions struct {
+	mu   sync.RWMutex
+	size int
+}
+
+func newEmbedderDimensions(cfg EmbedderConfig) *embedderDimensions {
+	size := cfg.Dimensions
+	if size == 0 {
+		size = knownEmbeddingDimensions[cfg.ModelName]
+	}
+	return &embedderDimensions{size: size}
+}
+
+func (d *embedderDimensions) Dimensions() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.size
+}
+
+// observe comprueba que los vectores tienen el tamaño esperado y lo registra si aún no se conocía
+func (d *embedderDimensions) observe(vectors [][]float64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, vector := range vectors {
+		if d.size == 0 {
+			d.size = len(vector)
+		}
+		if len(vector) != d.size {
+			return fmt.Errorf("el embedding tiene %d dimensiones, se esperaban %d", len(vector), d.size)
+		}
+	}
+	return nil
+}
+
+// embedInBatches divide los textos en lotes y concatena los resultados en orden
+func embedInBatches(ctx context.Context, texts []string, batchSize int, embed func(context.Context, []string) ([][]float64, error)) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		end := start + batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		batch, err := embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("se recibieron %d embeddings para %d textos", len(batch), end-start)
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func toFloat64(values []float32) []float64 {
+	vector := make([]float64, len(values))
+	for i, v := range values {
+		vector[i] = float64(v)
+	}
+	return vector
+}
+
+type openAIEmbedder struct {
+	*embedderDimensions
+	client    *openai.Client
+	config    EmbedderConfig
+	batchSize int
+}
+
+func newOpenAIEmbedder(cfg EmbedderConfig) (Embedder, error) {
+	if cfg.ModelName == "" {
+		cfg.ModelName = string(openai.SmallEmbedding3)
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 || batchSize > openAIEmbeddingBatchSize {
+		batchSize = openAIEmbeddingBatchSize
+	}
+
+	httpClient := newHTTPClient(cfg.Transport, cfg.Headers, newRetryPolicy(cfg.MaxAttempts, cfg.MaxElapsedTime))
+	return &openAIEmbedder{
+		embedderDimensions: newEmbedderDimensions(cfg),
+		client:             openai.NewClientWithConfig(openAIClientConfig(cfg.APIKey, cfg.BaseURL, cfg.Organization, httpClient)),
+		config:             cfg,
+		batchSize:          batchSize,
+	}, nil
+}
+
+func (o *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors, err := embedInBatches(ctx, texts, o.batchSize, o.embedBatch)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.observe(vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+func (o *openAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input:      texts,
+		Model:      openai.EmbeddingModel(o.config.ModelName),
+		Dimensions: o.config.Dimensions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generando embeddings de OpenAI: %w", wrapOpenAIError(o.config.Provider, err))
+	}
+
+	// La API no garantiza el orden de los resultados, se reordenan por índice
+	data := resp.Data
+	sort.Slice(data, func(i, j int) bool { return data[i].Index < data[j].Index })
+
+	vectors := make([][]float64, len(data))
+	for i, embedding := range data {
+		vectors[i] = toFloat64(embedding.Embedding)
+	}
+	return vectors, nil
+}
+
+// geminiEmbedder usa el cliente de la API de Gemini, que permite indicar
+// output_dimensionality
+type geminiEmbedder struct {
+	*embedderDimensions
+	client     *gl.GenerativeClient
+	model      string
+	dimensions int
+	batchSize  int
+}
+
+func newGeminiEmbedder(cfg EmbedderConfig) (Embedder, error) {
+	if cfg.ModelName == "" {
+		cfg.ModelName = "text-embedding-004"
+	}
+
+	httpClient := geminiHTTPClient(cfg.APIKey, cfg.Transport, cfg.Headers, newRetryPolicy(cfg.MaxAttempts, cfg.MaxElapsedTime))
+	client, err := gl.NewGenerativeRESTClient(context.Background(), geminiOptions(cfg.APIKey, cfg.BaseURL, httpClient)...)
+	if err != nil {
+		return nil, fmt.Errorf("error creando cliente Gemini: %w", err)
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 || batchSize > geminiEmbeddingBatchSize {
+		batchSize = geminiEmbeddingBatchSize
+	}
+
+	model := cfg.ModelName
+	if !strings.HasPrefix(model, "models/") {
+		model = "models/" + model
+	}
+
+	return &geminiEmbedder{
+		embedderDimensions: newEmbedderDimensions(cfg),
+		client:             client,
+		model:              model,
+		dimensions:         cfg.Dimensions,
+		batchSize:          batchSize,
+	}, nil
+}
+
+func (g *geminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors, err := embedInBatches(ctx, texts, g.batchSize, g.embedBatch)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.observe(vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+func (g *geminiEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	req := &pb.BatchEmbedContentsRequest{Model: g.model}
+	for _, text := range texts {
+		embedReq := &pb.EmbedContentRequest{
+			Model:   g.model,
+			Content: &pb.Content{Role: "user", Parts: []*pb.Part{{Data: &pb.Part_Text{Text: text}}}},
+		}
+		if g.dimensions > 0 {
+			dimensions := int32(g.dimensions)
+			embedReq.OutputDimensionality = &dimensions
+		}
+		req.Requests = append(req.Requests, embedReq)
+	}
+
+	resp, err := g.client.BatchEmbedContents(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("error generando embeddings de Gemini: %w", wrapGeminiError(err))
+	}
+
+	vectors := make([][]float64, len(resp.Embeddings))
+	for i, embedding := range resp.Embeddings {
+		vectors[i] = toFloat64(embedding.Values)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeminiEmbedderSendsOutputDimensionality(t *testing.T) {
+	var got struct {
+		Requests []struct {
+			Model                string `json:"model"`
+			OutputDimensionality int    `json:"outputDimensionality"`
+		} `json:"requests"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/models/text-embedding-004:batchEmbedContents") {
+			t.Errorf("ruta inesperada: %s", r.URL.Path)
+		}
+		raw, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Errorf("cuerpo no válido: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"embeddings": [{"values": [0.1, 0.2, 0.3]}, {"values": [0.4, 0.5, 0.6]}]}`)
+	}))
+	defer server.Close()
+
+	embedder, err := NewEmbedder(EmbedderConfig{Provider: Gemini, APIKey: "test-key", BaseURL: server.URL, Dimensions: 3, MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vectors, err := embedder.Embed(context.Background(), []string{"hola", "adiós"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 2 || len(vectors[1]) != 3 || embedder.Dimensions() != 3 {
+		t.Errorf("vectores inesperados: %v", vectors)
+	}
+	if len(got.Requests) != 2 || got.Requests[0].OutputDimensionality != 3 || got.Requests[0].Model != "models/text-embedding-004" {
+		t.Errorf("petición inesperada: %+v", got)
+	}
+}
@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/googleapi"
+)
+
+// Errores comunes a todos los proveedores. Se pueden comprobar con errors.Is
+// sobre cualquier error devuelto por el paquete; errors.As con *APIError da
+// acceso al código de estado y a la respuesta original del proveedor.
+var (
+	ErrAuth            = errors.New("credenciales no válidas o sin permisos")
+	ErrRateLimited     = errors.New("límite de peticiones alcanzado")
+	ErrQuotaExceeded   = errors.New("cuota o saldo agotado")
+	ErrContextLength   = errors.New("la petición supera la ventana de contexto del modelo")
+	ErrContentFiltered = errors.New("contenido bloqueado por los filtros del proveedor")
+	ErrInvalidRequest  = errors.New("petición no válida")
+	ErrUnavailable     = errors.New("servicio no disponible temporalmente")
+	// ErrEmptyResponse lo devuelven Chat y GenerateResponse cuando el modelo
+	// termina sin generar texto, por ejemplo porque solo pidió herramientas
+	ErrEmptyResponse = errors.New("el modelo no generó contenido de texto")
+)
+
+// APIError describe un error devuelto por la API de un proveedor
+type APIError struct {
+	Provider   Provider
+	StatusCode int
+	// Code es el tipo o código de error propio del proveedor
+	Code    string
+	Message string
+	// Payload contiene el cuerpo de la respuesta de error tal cual se recibió, si está disponible
+	Payload []byte
+	// Kind es uno de los errores comunes (ErrAuth, ErrRateLimited...) o nil si no se pudo clasificar
+	Kind error
+	// Err es el error original de la librería cliente, si lo hay
+	Err error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("error en la respuesta de %s", e.Provider)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (%d", e.StatusCode)
+		if e.Code != "" {
+			msg += " " + e.Code
+		}
+		msg += ")"
+	}
+	return msg + ": " + e.Message
+}
+
+// Unwrap permite usar errors.Is con los errores comunes y errors.As con el error original
+func (e *APIError) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// String devuelve el nombre del proveedor
+func (p Provider) String() string {
+	switch p {
+	case OpenAI:
+		return "OpenAI"
+	case Gemini:
+		return "Gemini"
+	case Anthropic:
+		return "Anthropic"
+	case Ollama:
+		return "Ollama"
+	case OpenAICompatible:
+		return "OpenAICompatible"
+	case Mock:
+		return "Mock"
+	default:
+		return fmt.Sprintf("Provider(%d)", int(p))
+	}
+}
+
+// classifyStatus asigna un error común a partir del código de estado HTTP
+func classifyStatus(status int) error {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusPaymentRequired:
+		return ErrQuotaExceeded
+	case status == http.StatusRequestEntityTooLarge:
+		return ErrContextLength
+	case isRetryableStatus(status):
+		return ErrUnavailable
+	case status >= 400 && status < 500:
+		return ErrInvalidRequest
+	default:
+		return nil
+	}
+}
+
+// looksLikeContextLength detecta los mensajes con los que los proveedores indican que el prompt es demasiado largo
+func looksLikeContextLength(message string) bool {
+	message = strings.ToLower(message)
+	for _, hint := range []string{"context length", "context_length", "maximum context", "too many tokens", "prompt is too long", "exceeds the maximum number of tokens", "input token count"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeQuota detecta los mensajes de cuota o saldo agotado
+func looksLikeQuota(message string) bool {
+	message = strings.ToLower(message)
+	for _, hint := range []string{"insufficient_quota", "exceeded your current quota", "credit balance", "billing"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// refineKind ajusta la clasificación por código de estado con el código y el mensaje del proveedor
+func refineKind(kind error, code, message string) error {
+	switch {
+	case looksLikeContextLength(code) || looksLikeContextLength(message):
+		return ErrContextLength
+	case looksLikeQuota(code) || looksLikeQuota(message):
+		return ErrQuotaExceeded
+	case strings.Contains(code, "content_filter") || strings.Contains(code, "content_policy"):
+		return ErrContentFiltered
+	}
+	return kind
+}
+
+// wrapOpenAIError convierte los errores de go-openai en *APIError; el resto se devuelve sin cambios
+func wrapOpenAIError(provider Provider, err error) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.Type
+		if c, ok := apiErr.Code.(string); ok && c != "" {
+			code = c
+		}
+		payload, _ := json.Marshal(apiErr)
+		return &APIError{
+			Provider:   provider,
+			StatusCode: apiErr.HTTPStatusCode,
+			Code:       code,
+			Message:    apiErr.Message,
+			Payload:    payload,
+			Kind:       refineKind(classifyStatus(apiErr.HTTPStatusCode), code, apiErr.Message),
+			Err:        err,
+		}
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return &APIError{
+			Provider:   provider,
+			StatusCode: reqErr.HTTPStatusCode,
+			Message:    reqErr.Error(),
+			Kind:       classifyStatus(reqErr.HTTPStatusCode),
+			Err:        err,
+		}
+	}
+
+	return err
+}
+
+// wrapGeminiError convierte los errores de la API de Google en *APIError; el resto se devuelve sin cambios
+func wrapGeminiError(err error) error {
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		var payload struct {
+			Error struct {
+				Status string `json:"status"`
+			} `json:"error"`
+		}
+		json.Unmarshal([]byte(gErr.Body), &payload)
+		return &APIError{
+			Provider:   Gemini,
+			StatusCode: gErr.Code,
+			Code:       payload.Error.Status,
+			Message:    gErr.Message,
+			Payload:    []byte(gErr.Body),
+			Kind:       refineKind(classifyStatus(gErr.Code), payload.Error.Status, gErr.Message),
+			Err:        err,
+		}
+	}
+
+	return err
+}
+
+// newHTTPAPIError construye un *APIError a partir de un cuerpo de error JSON ya leído
+func newHTTPAPIError(provider Provider, status int, code, message string, body []byte) *APIError {
+	if message == "" {
+		message = string(body)
+	}
+	return &APIError{
+		Provider:   provider,
+		StatusCode: status,
+		Code:       code,
+		Message:    message,
+		Payload:    body,
+		Kind:       refineKind(classifyStatus(status), code, message),
+	}
+}
@@ -1,75 +1,579 @@
 package llm
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/google/generative-ai-go/genai"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	gl "cloud.google.com/go/ai/generativelanguage/apiv1beta"
+	pb "cloud.google.com/go/ai/generativelanguage/apiv1beta/generativelanguagepb"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const geminiBaseURL = "https://generativelanguage.googleapis.com"
+
+// geminiParams son los parámetros de generación que admite Gemini
+const geminiParams = paramTopP | paramTopK | paramStopSequences | paramCandidateCount | paramSafetySettings
+
+// geminiMarshal y geminiUnmarshal codifican los mensajes de la API igual que su cliente REST
+var (
+	geminiMarshal   = protojson.MarshalOptions{AllowPartial: true, UseEnumNumbers: true}
+	geminiUnmarshal = protojson.UnmarshalOptions{AllowPartial: true, DiscardUnknown: true}
 )
 
 type geminiLLM struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
-	config Config
+	client  *gl.GenerativeClient
+	http    *http.Client
+	baseURL string
+	config  Config
 }
 
 func newGemini(cfg Config) (LLM, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(cfg.APIKey))
+	if err := checkGeminiConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	httpClient := geminiHTTPClient(cfg.APIKey, cfg.Transport, cfg.Headers, newRetryPolicy(cfg.MaxAttempts, cfg.MaxElapsedTime))
+	client, err := gl.NewGenerativeRESTClient(context.Background(), geminiOptions(cfg.APIKey, cfg.BaseURL, httpClient)...)
 	if err != nil {
 		return nil, fmt.Errorf("error creando cliente Gemini: %w", err)
 	}
 
-	model := client.GenerativeModel(cfg.ModelName)
-	model.SetTemperature(float32(cfg.Temperature))
+	baseURL := geminiBaseURL
+	if cfg.BaseURL != "" {
+		baseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
 
 	return &geminiLLM{
-		client: client,
-		model:  model,
-		config: cfg,
+		client:  client,
+		http:    httpClient,
+		baseURL: baseURL,
+		config:  cfg,
 	}, nil
 }
 
-func (g *geminiLLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
-	resp, err := g.model.GenerateContent(ctx, genai.Text(prompt))
+// checkGeminiConfig comprueba los parámetros de generación y los filtros de seguridad
+func checkGeminiConfig(cfg Config) error {
+	if err := checkParams(cfg, geminiParams); err != nil {
+		return err
+	}
+	_, err := geminiSafetySettings(cfg.SafetySettings)
+	return err
+}
+
+// generationConfig devuelve los parámetros de generación de la configuración
+func (g *geminiLLM) generationConfig() *pb.GenerationConfig {
+	temperature := float32(g.config.Temperature)
+	config := &pb.GenerationConfig{
+		Temperature:   &temperature,
+		StopSequences: g.config.StopSequences,
+	}
+	if g.config.MaxTokens > 0 {
+		maxTokens := int32(g.config.MaxTokens)
+		config.MaxOutputTokens = &maxTokens
+	}
+	if g.config.TopP != 0 {
+		topP := float32(g.config.TopP)
+		config.TopP = &topP
+	}
+	if g.config.TopK != 0 {
+		topK := int32(g.config.TopK)
+		config.TopK = &topK
+	}
+	if g.config.CandidateCount > 0 {
+		count := int32(g.config.CandidateCount)
+		config.CandidateCount = &count
+	}
+	return config
+}
+
+// geminiHTTPClient crea el cliente HTTP común de Gemini. Al inyectar un cliente
+// HTTP la librería de Google deja de añadir la clave, así que se envía como cabecera.
+func geminiHTTPClient(apiKey string, transport http.RoundTripper, headers map[string]string, policy retryPolicy) *http.Client {
+	allHeaders := map[string]string{"x-goog-api-key": apiKey}
+	for key, value := range headers {
+		allHeaders[key] = value
+	}
+	return newHTTPClient(transport, allHeaders, policy)
+}
+
+// geminiOptions devuelve las opciones de los clientes de la API de Gemini;
+// WithAPIKey se mantiene porque el cliente exige una opción de autenticación
+func geminiOptions(apiKey, baseURL string, httpClient *http.Client) []option.ClientOption {
+	opts := []option.ClientOption{
+		option.WithAPIKey(apiKey),
+		option.WithHTTPClient(httpClient),
+	}
+	if baseURL != "" {
+		opts = append(opts, option.WithEndpoint(baseURL))
+	}
+	return opts
+}
+
+func (g *geminiLLM) configuration() Config {
+	return g.config
+}
+
+func (g *geminiLLM) GenerateResponse(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	model, err := g.withOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	return model.Chat(ctx, []Message{UserMessage(prompt)})
+}
+
+// withOptions devuelve una copia que comparte los clientes pero usa la configuración con las opciones aplicadas
+func (g *geminiLLM) withOptions(opts []Option) (*geminiLLM, error) {
+	if len(opts) == 0 {
+		return g, nil
+	}
+	cfg := applyOptions(g.config, opts)
+	if err := checkGeminiConfig(cfg); err != nil {
+		return nil, err
+	}
+	return &geminiLLM{client: g.client, http: g.http, baseURL: g.baseURL, config: cfg}, nil
+}
+
+func (g *geminiLLM) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := g.ChatResponse(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	return responseText(resp)
+}
+
+func (g *geminiLLM) ChatResponse(ctx context.Context, messages []Message) (*Response, error) {
+	return g.ChatWithTools(ctx, messages, nil)
+}
+
+func (g *geminiLLM) ChatWithTools(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	req, err := g.request(ctx, messages)
 	if err != nil {
-		return "", fmt.Errorf("error generando respuesta de Gemini: %w", err)
+		return nil, err
+	}
+	req.Tools = geminiTools(tools)
+
+	start := time.Now()
+	resp, err := g.generate(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(resp.Candidates) == 0 {
-		return "", fmt.Errorf("no se generaron candidatos")
+		return nil, fmt.Errorf("no se generaron candidatos")
 	}
 
-	var result string
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if textPart, ok := part.(genai.Text); ok {
-			result += string(textPart)
+	candidate := resp.Candidates[0]
+	result := &Response{
+		FinishReason: geminiFinishReason(candidate.FinishReason),
+		Usage:        geminiUsage(resp.UsageMetadata),
+	}
+	if len(resp.Candidates) > 1 {
+		for _, c := range resp.Candidates {
+			result.Candidates = append(result.Candidates, geminiCandidateText(c))
 		}
 	}
+	for _, part := range candidate.GetContent().GetParts() {
+		switch data := part.Data.(type) {
+		case *pb.Part_Text:
+			result.Content += data.Text
+		case *pb.Part_FunctionCall:
+			args, err := json.Marshal(data.FunctionCall.GetArgs().AsMap())
+			if err != nil {
+				return nil, fmt.Errorf("error codificando los argumentos de %s: %w", data.FunctionCall.Name, err)
+			}
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				// Gemini no asigna identificadores a las llamadas
+				ID:        fmt.Sprintf("call_%d", len(result.ToolCalls)),
+				Name:      data.FunctionCall.Name,
+				Arguments: string(args),
+			})
+		}
+	}
+	if len(result.ToolCalls) > 0 {
+		result.FinishReason = FinishReasonToolCalls
+	}
 
-	if result == "" {
-		return "", fmt.Errorf("no se generó contenido de texto")
+	return finishResponse(result, g.config, start), nil
+}
+
+func (g *geminiLLM) nativeJSON(schema *Schema) bool {
+	return schema.closed()
+}
+
+func (g *geminiLLM) chatJSON(ctx context.Context, messages []Message, schema *Schema) (string, error) {
+	req, err := g.request(ctx, messages)
+	if err != nil {
+		return "", err
 	}
+	req.GenerationConfig.ResponseMimeType = "application/json"
+	req.GenerationConfig.ResponseSchema = schema.toGemini()
 
-	return result, nil
+	resp, err := g.generate(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	return extractGeminiText(resp)
 }
 
-func (g *geminiLLM) GenerateResponseAsync(ctx context.Context, prompt string) (<-chan string, <-chan error) {
-	respChan := make(chan string)
-	errChan := make(chan error)
+// StreamChat lee streamGenerateContent como Server-Sent Events. No se usa el
+// cliente de la API porque su lector de arrays JSON depende de cómo se
+// comportaba encoding/json antes de json/v2 y falla al llegar al cierre del array.
+func (g *geminiLLM) StreamChat(ctx context.Context, messages []Message) <-chan StreamEvent {
+	req, err := g.request(ctx, messages)
+	if err != nil {
+		return errorStream(err)
+	}
+
+	resp, err := g.stream(ctx, req)
+	if err != nil {
+		return errorStream(fmt.Errorf("error generando respuesta de Gemini: %w", wrapGeminiError(err)))
+	}
+
+	events := make(chan StreamEvent)
 
 	go func() {
-		defer close(respChan)
-		defer close(errChan)
+		defer close(events)
+		defer resp.Body.Close()
 
-		resp, err := g.GenerateResponse(ctx, prompt)
-		if err != nil {
-			errChan <- err
-			return
+		final := StreamEvent{Done: true}
+		reader := newSSEReader(resp.Body)
+		for {
+			event, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("error recibiendo el streaming de Gemini: %w", err)})
+				return
+			}
+
+			var chunk pb.GenerateContentResponse
+			if err := geminiUnmarshal.Unmarshal([]byte(event.Data), &chunk); err != nil {
+				sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("error al decodificar el streaming de Gemini: %w", err)})
+				return
+			}
+			if err := geminiBlocked(&chunk); err != nil {
+				sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("error recibiendo el streaming de Gemini: %w", err)})
+				return
+			}
+
+			if chunk.UsageMetadata != nil {
+				usage := geminiUsage(chunk.UsageMetadata)
+				final.Usage = &usage
+			}
+
+			if len(chunk.Candidates) == 0 {
+				continue
+			}
+
+			// Con CandidateCount > 1 solo se emite la primera alternativa
+			candidate := chunk.Candidates[0]
+			if candidate.GetIndex() != 0 {
+				continue
+			}
+			if candidate.FinishReason != pb.Candidate_FINISH_REASON_UNSPECIFIED {
+				final.FinishReason = geminiFinishReason(candidate.FinishReason)
+			}
+			for _, part := range candidate.GetContent().GetParts() {
+				if text := part.GetText(); text != "" {
+					if !sendEvent(ctx, events, StreamEvent{Delta: text}) {
+						return
+					}
+				}
+			}
 		}
 
-		respChan <- resp
+		sendEvent(ctx, events, final)
 	}()
 
-	return respChan, errChan
+	return events
+}
+
+func (g *geminiLLM) GenerateResponseAsync(ctx context.Context, prompt string, opts ...Option) (<-chan string, <-chan error) {
+	model, err := g.withOptions(opts)
+	if err != nil {
+		return streamToAsync(ctx, errorStream(err))
+	}
+	return streamToAsync(ctx, model.StreamChat(ctx, []Message{UserMessage(prompt)}))
+}
+
+// generate envía la petición completa con generateContent
+func (g *geminiLLM) generate(ctx context.Context, req *pb.GenerateContentRequest) (*pb.GenerateContentResponse, error) {
+	resp, err := g.client.GenerateContent(ctx, req)
+	if err == nil {
+		err = geminiBlocked(resp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generando respuesta de Gemini: %w", wrapGeminiError(err))
+	}
+	return resp, nil
+}
+
+// stream envía la petición a streamGenerateContent y devuelve la respuesta si
+// el código de estado es correcto
+func (g *geminiLLM) stream(ctx context.Context, req *pb.GenerateContentRequest) (*http.Response, error) {
+	body, err := geminiMarshal.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el cuerpo de la solicitud: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1beta/%s:streamGenerateContent?alt=sse", g.baseURL, req.Model)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error al crear la solicitud: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.http.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error al hacer la solicitud: %w", err)
+	}
+	if err := googleapi.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// request convierte la conversación en una petición a Gemini
+func (g *geminiLLM) request(ctx context.Context, messages []Message) (*pb.GenerateContentRequest, error) {
+	if err := validateMessages(messages); err != nil {
+		return nil, err
+	}
+
+	var system []*pb.Part
+	var contents []*pb.Content
+	// Gemini asocia cada resultado a su función por el nombre, así que se busca
+	// en las llamadas anteriores cuando el mensaje solo indica el id
+	toolNames := map[string]string{}
+	for i, msg := range messages {
+		if msg.Role == RoleSystem {
+			system = append(system, geminiText(msg.Content))
+			continue
+		}
+		for _, call := range msg.ToolCalls {
+			toolNames[call.ID] = call.Name
+		}
+		if msg.Role == RoleTool && msg.Name == "" {
+			msg.Name = toolNames[msg.ToolCallID]
+			if msg.Name == "" {
+				return nil, fmt.Errorf("el mensaje %d de herramienta responde a una llamada desconocida: %q", i, msg.ToolCallID)
+			}
+		}
+
+		role, parts, err := geminiParts(msg)
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range msg.Images {
+			data, mimeType, err := img.load(ctx, g.config.Transport)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, &pb.Part{Data: &pb.Part_InlineData{InlineData: &pb.Blob{MimeType: mimeType, Data: data}}})
+		}
+
+		// Gemini espera turnos alternos, así que se agrupan los mensajes consecutivos del mismo rol
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			continue
+		}
+		contents = append(contents, &pb.Content{Role: role, Parts: parts})
+	}
+
+	if len(contents) == 0 || contents[len(contents)-1].Role != "user" {
+		return nil, fmt.Errorf("el último mensaje de la conversación debe ser del usuario")
+	}
+
+	model := g.config.ModelName
+	if !strings.HasPrefix(model, "models/") {
+		model = "models/" + model
+	}
+	// Los filtros ya se validaron al crear la configuración
+	safety, _ := geminiSafetySettings(g.config.SafetySettings)
+
+	req := &pb.GenerateContentRequest{
+		Model:            model,
+		Contents:         contents,
+		SafetySettings:   safety,
+		GenerationConfig: g.generationConfig(),
+	}
+	if len(system) > 0 {
+		req.SystemInstruction = &pb.Content{Parts: system}
+	}
+	return req, nil
+}
+
+// geminiTools convierte las herramientas en declaraciones de funciones de Gemini
+func geminiTools(tools []Tool) []*pb.Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	declarations := make([]*pb.FunctionDeclaration, len(tools))
+	for i, tool := range tools {
+		declarations[i] = &pb.FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.Parameters.toGemini(),
+		}
+	}
+	return []*pb.Tool{{FunctionDeclarations: declarations}}
+}
+
+// geminiText crea una parte de texto
+func geminiText(text string) *pb.Part {
+	return &pb.Part{Data: &pb.Part_Text{Text: text}}
+}
+
+// geminiParts convierte un mensaje en el rol y las partes que espera Gemini
+func geminiParts(msg Message) (string, []*pb.Part, error) {
+	switch msg.Role {
+	case RoleAssistant:
+		var parts []*pb.Part
+		if msg.Content != "" {
+			parts = append(parts, geminiText(msg.Content))
+		}
+		for _, call := range msg.ToolCalls {
+			args := map[string]any{}
+			if call.Arguments != "" {
+				if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+					return "", nil, fmt.Errorf("argumentos no válidos en la llamada a %s: %w", call.Name, err)
+				}
+			}
+			argsStruct, err := structpb.NewStruct(args)
+			if err != nil {
+				return "", nil, fmt.Errorf("argumentos no válidos en la llamada a %s: %w", call.Name, err)
+			}
+			parts = append(parts, &pb.Part{Data: &pb.Part_FunctionCall{FunctionCall: &pb.FunctionCall{Name: call.Name, Args: argsStruct}}})
+		}
+		return "model", parts, nil
+	case RoleTool:
+		// Las respuestas de funciones deben ser objetos JSON
+		response := map[string]any{}
+		if err := json.Unmarshal([]byte(msg.Content), &response); err != nil {
+			response = map[string]any{"result": msg.Content}
+		}
+		responseStruct, err := structpb.NewStruct(response)
+		if err != nil {
+			return "", nil, fmt.Errorf("resultado no válido de %s: %w", msg.Name, err)
+		}
+		return "user", []*pb.Part{{Data: &pb.Part_FunctionResponse{FunctionResponse: &pb.FunctionResponse{Name: msg.Name, Response: responseStruct}}}}, nil
+	default:
+		if msg.Content == "" && len(msg.Images) > 0 {
+			return "user", nil, nil
+		}
+		return "user", []*pb.Part{geminiText(msg.Content)}, nil
+	}
+}
+
+// geminiSafetySettings convierte los filtros de seguridad al formato de la API
+func geminiSafetySettings(settings []SafetySetting) ([]*pb.SafetySetting, error) {
+	categories := map[HarmCategory]pb.HarmCategory{
+		HarmCategoryHarassment:       pb.HarmCategory_HARM_CATEGORY_HARASSMENT,
+		HarmCategoryHateSpeech:       pb.HarmCategory_HARM_CATEGORY_HATE_SPEECH,
+		HarmCategorySexuallyExplicit: pb.HarmCategory_HARM_CATEGORY_SEXUALLY_EXPLICIT,
+		HarmCategoryDangerousContent: pb.HarmCategory_HARM_CATEGORY_DANGEROUS_CONTENT,
+	}
+	thresholds := map[HarmBlockThreshold]pb.SafetySetting_HarmBlockThreshold{
+		BlockNone:           pb.SafetySetting_BLOCK_NONE,
+		BlockOnlyHigh:       pb.SafetySetting_BLOCK_ONLY_HIGH,
+		BlockMediumAndAbove: pb.SafetySetting_BLOCK_MEDIUM_AND_ABOVE,
+		BlockLowAndAbove:    pb.SafetySetting_BLOCK_LOW_AND_ABOVE,
+	}
+
+	var result []*pb.SafetySetting
+	for _, setting := range settings {
+		category, ok := categories[setting.Category]
+		if !ok {
+			return nil, fmt.Errorf("categoría de seguridad desconocida: %q", setting.Category)
+		}
+		threshold, ok := thresholds[setting.Threshold]
+		if !ok {
+			return nil, fmt.Errorf("umbral de seguridad desconocido: %q", setting.Threshold)
+		}
+		result = append(result, &pb.SafetySetting{Category: category, Threshold: threshold})
+	}
+	return result, nil
+}
+
+// geminiBlocked devuelve un error si los filtros de Gemini bloquearon la
+// petición o alguno de los candidatos
+func geminiBlocked(resp *pb.GenerateContentResponse) error {
+	if reason := resp.GetPromptFeedback().GetBlockReason(); reason != pb.GenerateContentResponse_PromptFeedback_BLOCK_REASON_UNSPECIFIED {
+		return &APIError{
+			Provider: Gemini,
+			Code:     "blocked",
+			Message:  fmt.Sprintf("petición bloqueada (%s)", reason),
+			Kind:     ErrContentFiltered,
+		}
+	}
+	for _, candidate := range resp.Candidates {
+		if candidate.FinishReason == pb.Candidate_SAFETY || candidate.FinishReason == pb.Candidate_RECITATION {
+			return &APIError{
+				Provider: Gemini,
+				Code:     "blocked",
+				Message:  fmt.Sprintf("respuesta bloqueada (%s)", candidate.FinishReason),
+				Kind:     ErrContentFiltered,
+			}
+		}
+	}
+	return nil
+}
+
+// geminiUsage convierte el consumo de tokens informado por Gemini
+func geminiUsage(usage *pb.GenerateContentResponse_UsageMetadata) Usage {
+	return Usage{
+		PromptTokens:     int(usage.GetPromptTokenCount()),
+		CompletionTokens: int(usage.GetCandidatesTokenCount()),
+		TotalTokens:      int(usage.GetTotalTokenCount()),
+	}
+}
+
+// geminiCandidateText concatena las partes de texto de un candidato
+func geminiCandidateText(candidate *pb.Candidate) string {
+	var text string
+	for _, part := range candidate.GetContent().GetParts() {
+		text += part.GetText()
+	}
+	return text
+}
+
+// extractGeminiText concatena las partes de texto del primer candidato
+func extractGeminiText(resp *pb.GenerateContentResponse) (string, error) {
+	if len(resp.Candidates) == 0 {
+		return "", fmt.Errorf("no se generaron candidatos")
+	}
+
+	result := geminiCandidateText(resp.Candidates[0])
+	if result == "" {
+		return "", ErrEmptyResponse
+	}
+
+	return result, nil
+}
+
+// geminiFinishReason traduce el motivo de finalización de Gemini al formato común
+func geminiFinishReason(reason pb.Candidate_FinishReason) FinishReason {
+	switch reason {
+	case pb.Candidate_STOP:
+		return FinishReasonStop
+	case pb.Candidate_MAX_TOKENS:
+		return FinishReasonLength
+	case pb.Candidate_SAFETY, pb.Candidate_RECITATION:
+		return FinishReasonContentFilter
+	default:
+		return FinishReasonOther
+	}
 }
@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	pb "cloud.google.com/go/ai/generativelanguage/apiv1beta/generativelanguagepb"
+)
+
+func TestGeminiRequestNamesToolResultsByCallID(t *testing.T) {
+	g := &geminiLLM{config: Config{ModelName: "gemini-1.5-flash"}}
+	req, err := g.request(context.Background(), []Message{
+		UserMessage("¿Qué tiempo hace en Madrid?"),
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_0", Name: "clima", Arguments: `{"ciudad":"Madrid"}`}}},
+		{Role: RoleTool, ToolCallID: "call_0", Content: "soleado"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := req.Contents[len(req.Contents)-1]
+	if last.Role != "user" || len(last.Parts) != 1 {
+		t.Fatalf("contenido inesperado: %+v", last)
+	}
+	response, ok := last.Parts[0].Data.(*pb.Part_FunctionResponse)
+	if !ok || response.FunctionResponse.Name != "clima" {
+		t.Errorf("la respuesta de la función no lleva el nombre de la llamada: %+v", last.Parts[0])
+	}
+}
+
+func TestGeminiRequestRejectsUnknownToolCallID(t *testing.T) {
+	g := &geminiLLM{config: Config{ModelName: "gemini-1.5-flash"}}
+	_, err := g.request(context.Background(), []Message{
+		UserMessage("¿Qué tiempo hace en Madrid?"),
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_0", Name: "clima"}}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: "soleado"},
+	})
+	if err == nil {
+		t.Fatal("se esperaba un error por el id de llamada desconocido")
+	}
+}
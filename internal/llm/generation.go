@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedParameter indica que el proveedor no admite alguno de los
+// parámetros de generación configurados
+var ErrUnsupportedParameter = errors.New("parámetro de generación no soportado")
+
+// HarmCategory es una categoría de contenido dañino para los filtros de seguridad
+type HarmCategory string
+
+const (
+	HarmCategoryHarassment       HarmCategory = "harassment"
+	HarmCategoryHateSpeech       HarmCategory = "hate_speech"
+	HarmCategorySexuallyExplicit HarmCategory = "sexually_explicit"
+	HarmCategoryDangerousContent HarmCategory = "dangerous_content"
+)
+
+// HarmBlockThreshold es el nivel de probabilidad a partir del cual se bloquea el contenido
+type HarmBlockThreshold string
+
+const (
+	BlockNone           HarmBlockThreshold = "none"
+	BlockOnlyHigh       HarmBlockThreshold = "only_high"
+	BlockMediumAndAbove HarmBlockThreshold = "medium_and_above"
+	BlockLowAndAbove    HarmBlockThreshold = "low_and_above"
+)
+
+// SafetySetting ajusta el filtro de seguridad de una categoría
+type SafetySetting struct {
+	Category  HarmCategory
+	Threshold HarmBlockThreshold
+}
+
+// Option modifica la configuración de una sola llamada a GenerateResponse
+type Option func(*Config)
+
+// WithTemperature cambia la temperatura de la llamada
+func WithTemperature(temperature float64) Option {
+	return func(cfg *Config) { cfg.Temperature = temperature }
+}
+
+// WithMaxTokens cambia el máximo de tokens generados
+func WithMaxTokens(maxTokens int) Option {
+	return func(cfg *Config) { cfg.MaxTokens = maxTokens }
+}
+
+// WithTopP limita el muestreo a los tokens que suman la probabilidad indicada
+func WithTopP(topP float64) Option {
+	return func(cfg *Config) { cfg.TopP = topP }
+}
+
+// WithTopK limita el muestreo a los k tokens más probables
+func WithTopK(topK int) Option {
+	return func(cfg *Config) { cfg.TopK = topK }
+}
+
+// WithStopSequences detiene la generación al encontrar alguna de las secuencias
+func WithStopSequences(stop ...string) Option {
+	return func(cfg *Config) { cfg.StopSequences = stop }
+}
+
+// WithPresencePenalty penaliza los tokens que ya han aparecido
+func WithPresencePenalty(penalty float64) Option {
+	return func(cfg *Config) { cfg.PresencePenalty = penalty }
+}
+
+// WithFrequencyPenalty penaliza los tokens según cuántas veces han aparecido
+func WithFrequencyPenalty(penalty float64) Option {
+	return func(cfg *Config) { cfg.FrequencyPenalty = penalty }
+}
+
+// WithSeed fija la semilla para obtener respuestas reproducibles
+func WithSeed(seed int) Option {
+	return func(cfg *Config) { cfg.Seed = &seed }
+}
+
+// WithCandidateCount pide varias respuestas alternativas
+func WithCandidateCount(n int) Option {
+	return func(cfg *Config) { cfg.CandidateCount = n }
+}
+
+// WithSafetySettings sustituye los filtros de seguridad de la llamada
+func WithSafetySettings(settings ...SafetySetting) Option {
+	return func(cfg *Config) { cfg.SafetySettings = settings }
+}
+
+// applyOptions devuelve una copia de la configuración con las opciones aplicadas
+func applyOptions(cfg Config, opts []Option) Config {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// generationParam identifica un parámetro de generación opcional
+type generationParam int
+
+const (
+	paramTopP generationParam = 1 << iota
+	paramTopK
+	paramStopSequences
+	paramPresencePenalty
+	paramFrequencyPenalty
+	paramSeed
+	paramCandidateCount
+	paramSafetySettings
+)
+
+// checkParams devuelve ErrUnsupportedParameter si la configuración usa algún
+// parámetro que no está entre los soportados por el proveedor
+func checkParams(cfg Config, supported generationParam) error {
+	used := []struct {
+		param generationParam
+		name  string
+		set   bool
+	}{
+		{paramTopP, "TopP", cfg.TopP != 0},
+		{paramTopK, "TopK", cfg.TopK != 0},
+		{paramStopSequences, "StopSequences", len(cfg.StopSequences) > 0},
+		{paramPresencePenalty, "PresencePenalty", cfg.PresencePenalty != 0},
+		{paramFrequencyPenalty, "FrequencyPenalty", cfg.FrequencyPenalty != 0},
+		{paramSeed, "Seed", cfg.Seed != nil},
+		{paramCandidateCount, "CandidateCount", cfg.CandidateCount > 1},
+		{paramSafetySettings, "SafetySettings", len(cfg.SafetySettings) > 0},
+	}
+
+	var unsupported []string
+	for _, u := range used {
+		if u.set && supported&u.param == 0 {
+			unsupported = append(unsupported, u.name)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%w: %s no admite %s", ErrUnsupportedParameter, cfg.Provider, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
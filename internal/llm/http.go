@@ -0,0 +1,35 @@
+package llm
+
+import (
+	"net/http"
+)
+
+// headerTransport añade cabeceras fijas a todas las peticiones
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newHTTPClient crea el cliente HTTP que usan los proveedores sobre el transporte
+// indicado (http.DefaultTransport si es nil), con las cabeceras adicionales
+// configuradas y reintentos ante errores transitorios
+func newHTTPClient(transport http.RoundTripper, headers map[string]string, policy retryPolicy) *http.Client {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if len(headers) > 0 {
+		transport = &headerTransport{headers: headers, base: transport}
+	}
+	if policy.maxAttempts > 1 {
+		transport = &retryTransport{policy: policy, base: transport, sleep: sleepContext}
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxImageSize limita el tamaño de las imágenes que se descargan de una URL
+const maxImageSize = 20 << 20
+
+// Image es una imagen adjunta a un mensaje del usuario. Debe indicarse una sola
+// fuente: la ruta de un archivo, los bytes con su tipo MIME o una URL. Si
+// MIMEType está vacío se deduce del contenido o de la extensión.
+type Image struct {
+	Path     string
+	Data     []byte
+	MIMEType string
+	URL      string
+}
+
+// ImageFile crea una imagen a partir de un archivo local
+func ImageFile(path string) Image {
+	return Image{Path: path}
+}
+
+// ImageBytes crea una imagen a partir de su contenido y tipo MIME
+func ImageBytes(data []byte, mimeType string) Image {
+	return Image{Data: data, MIMEType: mimeType}
+}
+
+// ImageURL crea una imagen accesible en una URL
+func ImageURL(url string) Image {
+	return Image{URL: url}
+}
+
+// UserMessageWithImages crea un mensaje del usuario con imágenes adjuntas
+func UserMessageWithImages(content string, images ...Image) Message {
+	return Message{Role: RoleUser, Content: content, Images: images}
+}
+
+// validate comprueba que la imagen tenga exactamente una fuente
+func (img Image) validate() error {
+	sources := 0
+	for _, set := range []bool{img.Path != "", len(img.Data) > 0, img.URL != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("la imagen debe tener una sola fuente (Path, Data o URL)")
+	}
+	return nil
+}
+
+// load devuelve el contenido y el tipo MIME de la imagen, leyendo el archivo o
+// descargando la URL si es necesario. Las descargas usan el transporte
+// configurado pero no las cabeceras del proveedor, para no enviar credenciales
+// a terceros.
+func (img Image) load(ctx context.Context, transport http.RoundTripper) ([]byte, string, error) {
+	data, mimeType := img.Data, img.MIMEType
+
+	switch {
+	case img.Path != "":
+		var err error
+		data, err = os.ReadFile(img.Path)
+		if err != nil {
+			return nil, "", fmt.Errorf("error al leer la imagen: %w", err)
+		}
+	case img.URL != "":
+		var contentType string
+		var err error
+		data, contentType, err = downloadImage(ctx, transport, img.URL)
+		if err != nil {
+			return nil, "", err
+		}
+		if mimeType == "" {
+			mimeType = contentType
+		}
+	}
+
+	if mimeType == "" || !strings.HasPrefix(mimeType, "image/") {
+		mimeType = http.DetectContentType(data)
+		// Si el contenido no permite reconocer el formato se recurre a la extensión
+		if !strings.HasPrefix(mimeType, "image/") && img.Path != "" {
+			mimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(img.Path)))
+		}
+	}
+	// Se descartan parámetros como "; charset=..." que algunos servidores añaden
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil, "", fmt.Errorf("el contenido no es una imagen (%s)", mimeType)
+	}
+	return data, mimeType, nil
+}
+
+// dataURL devuelve la imagen como URL data: en base64
+func (img Image) dataURL(ctx context.Context, transport http.RoundTripper) (string, error) {
+	data, mimeType, err := img.load(ctx, transport)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func downloadImage(ctx context.Context, transport http.RoundTripper, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error al crear la solicitud de la imagen: %w", err)
+	}
+
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error al descargar la imagen: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("error al descargar la imagen %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error al descargar la imagen: %w", err)
+	}
+	if len(data) > maxImageSize {
+		return nil, "", fmt.Errorf("la imagen %s supera el tamaño máximo de %d MB", url, maxImageSize>>20)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
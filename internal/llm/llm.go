@@ -3,6 +3,8 @@ package llm
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"time"
 )
 
 // Provider representa los diferentes proveedores de LLM soportados
@@ -12,21 +14,129 @@ const (
 	OpenAI Provider = iota
 	Gemini
 	Anthropic
+	Ollama
+	OpenAICompatible
+	Mock
 )
 
-// LLM define la interfaz para interactuar con modelos de lenguaje
+// Role identifica al autor de un mensaje dentro de una conversación
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+	RoleTool      Role = "tool"
+)
+
+// Message representa un turno de una conversación. Los mensajes del asistente
+// pueden incluir llamadas a herramientas y los mensajes con rol RoleTool llevan
+// el resultado de una de ellas, identificada por ToolCallID y Name. Los
+// mensajes del usuario pueden adjuntar imágenes para los modelos multimodales.
+type Message struct {
+	Role       Role
+	Content    string
+	Images     []Image
+	ToolCalls  []ToolCall
+	ToolCallID string
+	Name       string
+}
+
+// FinishReason indica por qué el modelo dejó de generar, normalizado entre proveedores
+type FinishReason string
+
+const (
+	FinishReasonStop          FinishReason = "stop"
+	FinishReasonLength        FinishReason = "length"
+	FinishReasonContentFilter FinishReason = "content_filter"
+	FinishReasonToolCalls     FinishReason = "tool_calls"
+	FinishReasonOther         FinishReason = "other"
+)
+
+// Usage contiene el consumo de tokens informado por el proveedor
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// StreamEvent representa un fragmento de una respuesta en streaming.
+// El último evento del canal tiene Done a true e incluye el motivo de
+// finalización y el consumo, o bien Err si la generación falló.
+type StreamEvent struct {
+	Delta        string
+	Done         bool
+	FinishReason FinishReason
+	Usage        *Usage
+	Err          error
+}
+
+// Response representa la respuesta completa de un modelo, con el consumo de
+// tokens, la latencia de la llamada y su coste según la tabla de precios.
+// Backend solo lo rellena un Router, con el nombre del backend que respondió,
+// y Cached indica que la respuesta se sirvió desde un CachedLLM sin coste.
+// Si se piden varias respuestas con CandidateCount, Content es la primera y
+// Candidates contiene el texto de todas.
+type Response struct {
+	Content      string
+	Candidates   []string
+	ToolCalls    []ToolCall
+	FinishReason FinishReason
+	Model        string
+	Usage        Usage
+	Latency      time.Duration
+	Cost         float64
+	Backend      string
+	Cached       bool
+}
+
+// LLM define la interfaz para interactuar con modelos de lenguaje.
+// GenerateResponse y Chat solo devuelven el texto, así que si el modelo no
+// genera ninguno fallan con ErrEmptyResponse en lugar de devolver una cadena
+// vacía; ChatResponse y ChatWithTools devuelven la Response tal cual, con o
+// sin texto.
 type LLM interface {
-	GenerateResponse(ctx context.Context, prompt string) (string, error)
-	GenerateResponseAsync(ctx context.Context, prompt string) (<-chan string, <-chan error)
+	GenerateResponse(ctx context.Context, prompt string, opts ...Option) (string, error)
+	GenerateResponseAsync(ctx context.Context, prompt string, opts ...Option) (<-chan string, <-chan error)
+	Chat(ctx context.Context, messages []Message) (string, error)
+	ChatResponse(ctx context.Context, messages []Message) (*Response, error)
+	StreamChat(ctx context.Context, messages []Message) <-chan StreamEvent
+	ChatWithTools(ctx context.Context, messages []Message, tools []Tool) (*Response, error)
 }
 
-// Config contiene la configuración para crear una instancia de LLM
+// Config contiene la configuración para crear una instancia de LLM.
+// BaseURL, Headers y Organization permiten apuntar a servidores propios o
+// compatibles con la API de OpenAI (vLLM, LM Studio, Ollama...).
+// MaxAttempts y MaxElapsedTime limitan los reintentos ante errores
+// transitorios (3 intentos y 2 minutos por defecto; MaxAttempts 1 los desactiva).
+// Prices se usa para calcular el coste de cada Response (DefaultPrices si es nil).
+// Mock contiene el guion de respuestas cuando Provider es Mock. Transport
+// sustituye al transporte HTTP por defecto, por ejemplo con un Recorder.
+// El resto de parámetros de generación son opcionales (el valor cero deja el
+// del proveedor) y New devuelve ErrUnsupportedParameter si el proveedor no
+// admite alguno de los indicados.
 type Config struct {
-	Provider    Provider
-	ModelName   string
-	APIKey      string
-	MaxTokens   int
-	Temperature float64
+	Provider         Provider
+	ModelName        string
+	APIKey           string
+	MaxTokens        int
+	Temperature      float64
+	TopP             float64
+	TopK             int
+	StopSequences    []string
+	PresencePenalty  float64
+	FrequencyPenalty float64
+	Seed             *int
+	CandidateCount   int
+	SafetySettings   []SafetySetting
+	BaseURL          string
+	Headers          map[string]string
+	Organization     string
+	MaxAttempts      int
+	MaxElapsedTime   time.Duration
+	Prices           PriceTable
+	Mock             *MockConfig
+	Transport        http.RoundTripper
 }
 
 // New crea una nueva instancia de LLM basada en la configuración proporcionada
@@ -38,7 +148,142 @@ func New(cfg Config) (LLM, error) {
 		return newGemini(cfg)
 	case Anthropic:
 		return newAnthropic(cfg)
+	case Ollama:
+		return newOllama(cfg)
+	case OpenAICompatible:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("el proveedor compatible con OpenAI requiere BaseURL")
+		}
+		return newOpenAI(cfg)
+	case Mock:
+		mock, err := newMock(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return mock, nil
 	default:
 		return nil, fmt.Errorf("proveedor LLM no soportado: %v", cfg.Provider)
 	}
 }
+
+// SystemMessage crea un mensaje con instrucciones de sistema
+func SystemMessage(content string) Message {
+	return Message{Role: RoleSystem, Content: content}
+}
+
+// UserMessage crea un mensaje del usuario
+func UserMessage(content string) Message {
+	return Message{Role: RoleUser, Content: content}
+}
+
+// AssistantMessage crea un mensaje del asistente
+func AssistantMessage(content string) Message {
+	return Message{Role: RoleAssistant, Content: content}
+}
+
+// validateMessages comprueba que la conversación no esté vacía y que todos los roles sean conocidos
+func validateMessages(messages []Message) error {
+	if len(messages) == 0 {
+		return fmt.Errorf("la conversación no contiene mensajes")
+	}
+	for i, msg := range messages {
+		switch msg.Role {
+		case RoleSystem, RoleUser, RoleAssistant:
+		case RoleTool:
+			if msg.ToolCallID == "" && msg.Name == "" {
+				return fmt.Errorf("el mensaje %d de herramienta no indica a qué llamada responde", i)
+			}
+		default:
+			return fmt.Errorf("rol desconocido en el mensaje %d: %q", i, msg.Role)
+		}
+		if len(msg.Images) > 0 && msg.Role != RoleUser {
+			return fmt.Errorf("el mensaje %d adjunta imágenes pero solo se admiten en mensajes del usuario", i)
+		}
+		for j, img := range msg.Images {
+			if err := img.validate(); err != nil {
+				return fmt.Errorf("mensaje %d, imagen %d: %w", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// responseText devuelve el texto de la respuesta, o ErrEmptyResponse si no lo hay
+func responseText(resp *Response) (string, error) {
+	if resp.Content == "" {
+		return "", fmt.Errorf("%w (motivo de finalización: %s)", ErrEmptyResponse, resp.FinishReason)
+	}
+	return resp.Content, nil
+}
+
+// sendEvent envía un evento al canal salvo que el contexto se haya cancelado
+func sendEvent(ctx context.Context, events chan<- StreamEvent, event StreamEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// errorStream devuelve un canal que solo contiene el error indicado
+func errorStream(err error) <-chan StreamEvent {
+	events := make(chan StreamEvent, 1)
+	events <- StreamEvent{Done: true, Err: err}
+	close(events)
+	return events
+}
+
+// asyncToStream adapta los canales de GenerateResponseAsync a un stream de
+// eventos. Si se cancela ctx deja de enviar y cierra el canal.
+func asyncToStream(ctx context.Context, respChan <-chan string, errChan <-chan error) <-chan StreamEvent {
+	events := make(chan StreamEvent)
+
+	go func() {
+		defer close(events)
+
+		for delta := range respChan {
+			if !sendEvent(ctx, events, StreamEvent{Delta: delta}) {
+				return
+			}
+		}
+		if err := <-errChan; err != nil {
+			sendEvent(ctx, events, StreamEvent{Done: true, Err: err})
+			return
+		}
+		sendEvent(ctx, events, StreamEvent{Done: true})
+	}()
+
+	return events
+}
+
+// streamToAsync adapta un stream de eventos a los canales de GenerateResponseAsync,
+// enviando cada fragmento de texto según llega. Si se cancela ctx deja de
+// enviar y devuelve el error del contexto.
+func streamToAsync(ctx context.Context, events <-chan StreamEvent) (<-chan string, <-chan error) {
+	respChan := make(chan string)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(respChan)
+		defer close(errChan)
+
+		for event := range events {
+			if event.Err != nil {
+				errChan <- event.Err
+				return
+			}
+			if event.Delta == "" {
+				continue
+			}
+			select {
+			case respChan <- event.Delta:
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return respChan, errChan
+}
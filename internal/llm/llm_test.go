@@ -0,0 +1,148 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// endlessStream envía fragmentos hasta que se cancela el contexto
+func endlessStream(ctx context.Context) <-chan StreamEvent {
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+		for sendEvent(ctx, events, StreamEvent{Delta: "x"}) {
+		}
+	}()
+	return events
+}
+
+func TestStreamToAsyncStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	respChan, errChan := streamToAsync(ctx, endlessStream(ctx))
+	<-respChan
+	cancel()
+
+	select {
+	case err := <-errChan:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("se esperaba context.Canceled, se obtuvo %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("streamToAsync sigue enviando tras cancelar el contexto")
+	}
+}
+
+func TestAsyncToStreamStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	respChan := make(chan string)
+	errChan := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer close(respChan)
+		for {
+			select {
+			case respChan <- "x":
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	events := asyncToStream(ctx, respChan, errChan)
+	<-events
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("el productor sigue bloqueado tras cancelar el contexto")
+	}
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("asyncToStream no cierra el canal tras cancelar el contexto")
+		}
+	}
+}
+
+func TestAsyncToStreamForwardsEvents(t *testing.T) {
+	respChan, errChan := streamToAsync(context.Background(), asyncToStream(context.Background(), stringChan("Hola", " mundo"), errorChan(nil)))
+	var content string
+	for delta := range respChan {
+		content += delta
+	}
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+	if content != "Hola mundo" {
+		t.Fatalf("contenido inesperado: %q", content)
+	}
+}
+
+func stringChan(values ...string) <-chan string {
+	ch := make(chan string, len(values))
+	for _, v := range values {
+		ch <- v
+	}
+	close(ch)
+	return ch
+}
+
+func errorChan(err error) <-chan error {
+	ch := make(chan error, 1)
+	ch <- err
+	close(ch)
+	return ch
+}
+
+func TestChatFailsWithoutText(t *testing.T) {
+	// Cada proveedor responde solo con una llamada a una herramienta
+	cases := []struct {
+		name     string
+		provider Provider
+		body     string
+	}{
+		{"openai", OpenAI, `{"choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"clima","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`},
+		{"anthropic", Anthropic, `{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"clima","input":{}}],"stop_reason":"tool_use"}`},
+		{"gemini", Gemini, `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"clima","args":{}}}]},"finishReason":"STOP"}]}`},
+		{"ollama", Ollama, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"clima","arguments":{}}}]},"done":true}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, tc.body)
+			}))
+			defer server.Close()
+
+			model, err := New(Config{Provider: tc.provider, ModelName: "modelo", APIKey: "test-key", BaseURL: server.URL, MaxAttempts: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := model.Chat(context.Background(), []Message{UserMessage("¿Qué tiempo hace?")})
+			if !errors.Is(err, ErrEmptyResponse) || content != "" {
+				t.Errorf("se esperaba ErrEmptyResponse, se obtuvo %q, %v", content, err)
+			}
+		})
+	}
+
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{{ToolCalls: []ToolCall{{Name: "clima"}}, Repeat: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mock.GenerateResponse(context.Background(), "¿Qué tiempo hace?"); !errors.Is(err, ErrEmptyResponse) {
+		t.Errorf("el mock debe seguir el mismo contrato, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockResponse es una respuesta programada del proveedor Mock. Pattern es una
+// expresión regular que se compara con el último mensaje del usuario (vacía
+// coincide con todo). Cada respuesta se usa una sola vez salvo que Repeat sea
+// true. Si Err no es nil la llamada falla con ese error; en streaming se
+// envían antes los Chunks indicados, lo que permite simular cortes a mitad.
+type MockResponse struct {
+	Pattern      string
+	Content      string
+	ToolCalls    []ToolCall
+	FinishReason FinishReason
+	Usage        Usage
+	Chunks       []string
+	Latency      time.Duration
+	Err          error
+	Repeat       bool
+}
+
+// MockConfig contiene el guion del proveedor Mock. ChunkDelay es la espera
+// entre fragmentos en streaming.
+type MockConfig struct {
+	Responses  []MockResponse
+	ChunkDelay time.Duration
+}
+
+// MockCall registra una llamada recibida por el proveedor Mock. Config es la
+// configuración efectiva, con las opciones de la llamada aplicadas.
+type MockCall struct {
+	Method   string
+	Messages []Message
+	Tools    []Tool
+	Config   Config
+}
+
+// MockLLM es un proveedor determinista para pruebas que responde según un
+// guion sin hacer peticiones de red. Se crea con NewMock o con llm.New y
+// Provider Mock; en ese caso se obtiene con una aserción de tipo a *MockLLM.
+type MockLLM struct {
+	mu         sync.Mutex
+	config     Config
+	chunkDelay time.Duration
+	responses  []mockEntry
+	calls      []MockCall
+}
+
+type mockEntry struct {
+	response MockResponse
+	pattern  *regexp.Regexp
+	used     bool
+}
+
+// NewMock crea un proveedor Mock con el guion indicado
+func NewMock(script MockConfig) (*MockLLM, error) {
+	return newMock(Config{Provider: Mock, ModelName: "mock", Mock: &script})
+}
+
+func newMock(cfg Config) (*MockLLM, error) {
+	m := &MockLLM{config: cfg}
+	if cfg.Mock == nil {
+		return m, nil
+	}
+
+	m.chunkDelay = cfg.Mock.ChunkDelay
+	for i, response := range cfg.Mock.Responses {
+		entry := mockEntry{response: response}
+		if response.Pattern != "" {
+			pattern, err := regexp.Compile(response.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("patrón no válido en la respuesta %d del mock: %w", i, err)
+			}
+			entry.pattern = pattern
+		}
+		m.responses = append(m.responses, entry)
+	}
+	return m, nil
+}
+
+// Calls devuelve una copia de las llamadas recibidas hasta ahora
+func (m *MockLLM) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// Reset borra las llamadas registradas y vuelve a habilitar todas las respuestas del guion
+func (m *MockLLM) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+	for i := range m.responses {
+		m.responses[i].used = false
+	}
+}
+
+func (m *MockLLM) configuration() Config {
+	return m.config
+}
+
+func (m *MockLLM) GenerateResponse(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	resp, err := m.complete(ctx, "GenerateResponse", []Message{UserMessage(prompt)}, nil, opts)
+	if err != nil {
+		return "", err
+	}
+	return responseText(resp)
+}
+
+func (m *MockLLM) GenerateResponseAsync(ctx context.Context, prompt string, opts ...Option) (<-chan string, <-chan error) {
+	return streamToAsync(ctx, m.stream(ctx, "GenerateResponseAsync", []Message{UserMessage(prompt)}, opts))
+}
+
+func (m *MockLLM) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := m.complete(ctx, "Chat", messages, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return responseText(resp)
+}
+
+func (m *MockLLM) ChatResponse(ctx context.Context, messages []Message) (*Response, error) {
+	return m.complete(ctx, "ChatResponse", messages, nil, nil)
+}
+
+func (m *MockLLM) ChatWithTools(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	return m.complete(ctx, "ChatWithTools", messages, tools, nil)
+}
+
+func (m *MockLLM) StreamChat(ctx context.Context, messages []Message) <-chan StreamEvent {
+	return m.stream(ctx, "StreamChat", messages, nil)
+}
+
+func (m *MockLLM) stream(ctx context.Context, method string, messages []Message, opts []Option) <-chan StreamEvent {
+	if err := validateMessages(messages); err != nil {
+		return errorStream(err)
+	}
+
+	scripted, err := m.next(method, messages, nil, applyOptions(m.config, opts))
+	if err != nil {
+		return errorStream(err)
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+
+		if err := sleepContext(ctx, scripted.Latency); err != nil {
+			sendEvent(ctx, events, StreamEvent{Done: true, Err: err})
+			return
+		}
+
+		chunks := scripted.Chunks
+		if chunks == nil && scripted.Err == nil {
+			chunks = splitMockChunks(scripted.Content)
+		}
+		for i, chunk := range chunks {
+			if i > 0 {
+				if err := sleepContext(ctx, m.chunkDelay); err != nil {
+					sendEvent(ctx, events, StreamEvent{Done: true, Err: err})
+					return
+				}
+			}
+			if !sendEvent(ctx, events, StreamEvent{Delta: chunk}) {
+				return
+			}
+		}
+
+		if scripted.Err != nil {
+			sendEvent(ctx, events, StreamEvent{Done: true, Err: scripted.Err})
+			return
+		}
+		resp := m.response(scripted, messages, time.Now())
+		sendEvent(ctx, events, StreamEvent{Done: true, FinishReason: resp.FinishReason, Usage: &resp.Usage})
+	}()
+
+	return events
+}
+
+// complete registra la llamada y devuelve la respuesta programada tras su latencia
+func (m *MockLLM) complete(ctx context.Context, method string, messages []Message, tools []Tool, opts []Option) (*Response, error) {
+	if err := validateMessages(messages); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	scripted, err := m.next(method, messages, tools, applyOptions(m.config, opts))
+	if err != nil {
+		return nil, err
+	}
+	if err := sleepContext(ctx, scripted.Latency); err != nil {
+		return nil, err
+	}
+	if scripted.Err != nil {
+		return nil, scripted.Err
+	}
+	return m.response(scripted, messages, start), nil
+}
+
+// next registra la llamada y busca la primera respuesta disponible cuyo patrón coincida
+func (m *MockLLM) next(method string, messages []Message, tools []Tool, cfg Config) (MockResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, MockCall{
+		Method:   method,
+		Messages: append([]Message(nil), messages...),
+		Tools:    append([]Tool(nil), tools...),
+		Config:   cfg,
+	})
+
+	prompt := lastUserContent(messages)
+	for i := range m.responses {
+		entry := &m.responses[i]
+		if entry.used {
+			continue
+		}
+		if entry.pattern != nil && !entry.pattern.MatchString(prompt) {
+			continue
+		}
+		if !entry.response.Repeat {
+			entry.used = true
+		}
+		return entry.response, nil
+	}
+
+	return MockResponse{}, fmt.Errorf("el mock no tiene ninguna respuesta para %q", prompt)
+}
+
+// response construye la Response de una respuesta programada, estimando el
+// consumo si el guion no lo indica
+func (m *MockLLM) response(scripted MockResponse, messages []Message, start time.Time) *Response {
+	resp := &Response{
+		Content:      scripted.Content,
+		ToolCalls:    scripted.ToolCalls,
+		FinishReason: scripted.FinishReason,
+		Usage:        scripted.Usage,
+	}
+	if resp.FinishReason == "" {
+		resp.FinishReason = FinishReasonStop
+		if len(resp.ToolCalls) > 0 {
+			resp.FinishReason = FinishReasonToolCalls
+		}
+	}
+	if resp.Usage == (Usage{}) {
+		resp.Usage.PromptTokens = estimateTokens(messages)
+		resp.Usage.CompletionTokens = estimateTokens([]Message{{Content: scripted.Content}}) - 4
+	}
+	return finishResponse(resp, m.config, start)
+}
+
+// lastUserContent devuelve el contenido del último mensaje del usuario
+func lastUserContent(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// splitMockChunks divide el contenido en fragmentos de una palabra, conservando los espacios
+func splitMockChunks(content string) []string {
+	var chunks []string
+	for len(content) > 0 {
+		end := strings.IndexByte(content[1:], ' ')
+		if end < 0 {
+			chunks = append(chunks, content)
+			break
+		}
+		chunks = append(chunks, content[:end+1])
+		content = content[end+1:]
+	}
+	return chunks
+}
@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMockScriptedResponses(t *testing.T) {
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{
+		{Pattern: "(?i)tiempo", Content: "Soleado", Repeat: true},
+		{Content: "Primera"},
+		{Content: "Segunda", Usage: Usage{PromptTokens: 3, CompletionTokens: 2}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		prompt string
+		want   string
+	}{
+		{"¿Qué TIEMPO hace?", "Soleado"},
+		{"Hola", "Primera"},
+		{"¿Y mañana qué tiempo hará?", "Soleado"},
+		{"Otra", "Segunda"},
+	} {
+		got, err := mock.GenerateResponse(ctx, tc.prompt)
+		if err != nil || got != tc.want {
+			t.Errorf("%q: se obtuvo %q (%v), se esperaba %q", tc.prompt, got, err, tc.want)
+		}
+	}
+
+	if _, err := mock.GenerateResponse(ctx, "Nada más"); err == nil {
+		t.Error("sin respuestas disponibles se esperaba un error")
+	}
+
+	mock.Reset()
+	resp, err := mock.ChatResponse(ctx, []Message{UserMessage("Hola")})
+	if err != nil || resp.Content != "Primera" || resp.FinishReason != FinishReasonStop {
+		t.Fatalf("Reset debe volver a habilitar el guion: %+v, %v", resp, err)
+	}
+	if resp.Usage.PromptTokens == 0 || resp.Usage.TotalTokens != resp.Usage.PromptTokens+resp.Usage.CompletionTokens {
+		t.Errorf("consumo estimado inesperado: %+v", resp.Usage)
+	}
+	if resp.Model != "mock" {
+		t.Errorf("modelo inesperado: %q", resp.Model)
+	}
+}
+
+func TestMockToolCallsAndErrors(t *testing.T) {
+	boom := errors.New("fallo simulado")
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{
+		{ToolCalls: []ToolCall{{ID: "call_0", Name: "clima", Arguments: `{"ciudad":"Madrid"}`}}},
+		{Err: boom},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := mock.ChatWithTools(context.Background(), []Message{UserMessage("¿Qué tiempo hace?")}, []Tool{{Name: "clima"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.FinishReason != FinishReasonToolCalls || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "clima" {
+		t.Errorf("respuesta inesperada: %+v", resp)
+	}
+
+	if _, err := mock.Chat(context.Background(), []Message{UserMessage("Hola")}); !errors.Is(err, boom) {
+		t.Errorf("se esperaba el error programado, se obtuvo %v", err)
+	}
+
+	if _, err := NewMock(MockConfig{Responses: []MockResponse{{Pattern: "("}}}); err == nil {
+		t.Error("un patrón no válido debe dar error")
+	}
+}
+
+func TestMockStreaming(t *testing.T) {
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{
+		{Content: "Hola mundo cruel"},
+		{Chunks: []string{"Empie", "za"}, Err: errors.New("conexión cortada")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deltas []string
+	var last StreamEvent
+	for event := range mock.StreamChat(context.Background(), []Message{UserMessage("Hola")}) {
+		if event.Done {
+			last = event
+			continue
+		}
+		deltas = append(deltas, event.Delta)
+	}
+	if strings.Join(deltas, "|") != "Hola| mundo| cruel" {
+		t.Errorf("fragmentos inesperados: %q", deltas)
+	}
+	if last.Err != nil || last.FinishReason != FinishReasonStop || last.Usage == nil {
+		t.Errorf("evento final inesperado: %+v", last)
+	}
+
+	respChan, errChan := mock.GenerateResponseAsync(context.Background(), "Otra vez")
+	var content string
+	for delta := range respChan {
+		content += delta
+	}
+	if err := <-errChan; err == nil || err.Error() != "conexión cortada" {
+		t.Errorf("se esperaba el error programado, se obtuvo %v", err)
+	}
+	if content != "Empieza" {
+		t.Errorf("los fragmentos previos al corte deben llegar: %q", content)
+	}
+}
+
+func TestMockStreamingStopsOnCancel(t *testing.T) {
+	mock, err := NewMock(MockConfig{
+		Responses:  []MockResponse{{Content: "uno dos tres cuatro"}},
+		ChunkDelay: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := mock.StreamChat(ctx, []Message{UserMessage("Hola")})
+	if first := <-events; first.Delta != "uno" {
+		t.Fatalf("primer fragmento inesperado: %+v", first)
+	}
+	cancel()
+
+	select {
+	case <-drain(events):
+	case <-time.After(time.Second):
+		t.Fatal("el stream no termina al cancelar el contexto")
+	}
+}
+
+func drain(events <-chan StreamEvent) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range events {
+		}
+		close(done)
+	}()
+	return done
+}
+
+func TestMockRecordsCalls(t *testing.T) {
+	mock, err := New(Config{Provider: Mock, ModelName: "guion", Temperature: 0.2, Mock: &MockConfig{
+		Responses: []MockResponse{{Content: "ok", Repeat: true}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mock.(*MockLLM)
+	ctx := context.Background()
+
+	if _, err := m.GenerateResponse(ctx, "Hola", WithTemperature(0.9), WithMaxTokens(50)); err != nil {
+		t.Fatal(err)
+	}
+	conversation := []Message{SystemMessage("Sé breve."), UserMessage("¿Qué tal?")}
+	if _, err := m.ChatWithTools(ctx, conversation, []Tool{{Name: "buscar"}}); err != nil {
+		t.Fatal(err)
+	}
+	for range m.StreamChat(ctx, conversation) {
+	}
+	conversation[1].Content = "modificado"
+
+	calls := m.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("se esperaban 3 llamadas, hay %d", len(calls))
+	}
+	if calls[0].Method != "GenerateResponse" || calls[0].Config.Temperature != 0.9 || calls[0].Config.MaxTokens != 50 {
+		t.Errorf("la llamada debe registrar las opciones aplicadas: %+v", calls[0])
+	}
+	if calls[1].Method != "ChatWithTools" || len(calls[1].Tools) != 1 || calls[1].Config.Temperature != 0.2 {
+		t.Errorf("llamada inesperada: %+v", calls[1])
+	}
+	if calls[2].Method != "StreamChat" || calls[2].Messages[1].Content != "¿Qué tal?" {
+		t.Errorf("los mensajes registrados deben ser una copia: %+v", calls[2])
+	}
+
+	m.Reset()
+	if len(m.Calls()) != 0 {
+		t.Error("Reset debe borrar las llamadas registradas")
+	}
+}
@@ -0,0 +1,435 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const ollamaBaseURL = "http://localhost:11434"
+
+type ollamaLLM struct {
+	config  Config
+	client  *http.Client
+	baseURL string
+}
+
+// ollamaParams son los parámetros de generación que admite Ollama
+const ollamaParams = paramTopP | paramTopK | paramStopSequences | paramPresencePenalty | paramFrequencyPenalty | paramSeed
+
+func newOllama(cfg Config) (LLM, error) {
+	if err := checkParams(cfg, ollamaParams); err != nil {
+		return nil, err
+	}
+
+	return &ollamaLLM{
+		config:  cfg,
+		client:  newHTTPClient(cfg.Transport, cfg.Headers, newRetryPolicy(cfg.MaxAttempts, cfg.MaxElapsedTime)),
+		baseURL: ollamaBaseURLFor(cfg.BaseURL),
+	}, nil
+}
+
+// ollamaBaseURLFor devuelve la URL del servidor de Ollama, local por defecto
+func ollamaBaseURLFor(baseURL string) string {
+	if baseURL == "" {
+		return ollamaBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+// ollamaToolCall es una llamada a herramienta en el formato de Ollama
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaMessage es un mensaje de /api/chat
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// ollamaTool es la declaración de una herramienta
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string  `json:"name"`
+		Description string  `json:"description,omitempty"`
+		Parameters  *Schema `json:"parameters"`
+	} `json:"function"`
+}
+
+// ollamaRequest es el cuerpo de una petición a /api/chat
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Tools    []ollamaTool           `json:"tools,omitempty"`
+	Format   interface{}            `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaResponse es una respuesta de /api/chat; en streaming cada línea es una de ellas
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (o *ollamaLLM) configuration() Config {
+	return o.config
+}
+
+func (o *ollamaLLM) GenerateResponse(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	model, err := o.withOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	return model.Chat(ctx, []Message{UserMessage(prompt)})
+}
+
+// withOptions devuelve una copia que comparte el cliente pero usa la configuración con las opciones aplicadas
+func (o *ollamaLLM) withOptions(opts []Option) (*ollamaLLM, error) {
+	if len(opts) == 0 {
+		return o, nil
+	}
+	cfg := applyOptions(o.config, opts)
+	if err := checkParams(cfg, ollamaParams); err != nil {
+		return nil, err
+	}
+	model := *o
+	model.config = cfg
+	return &model, nil
+}
+
+func (o *ollamaLLM) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := o.complete(ctx, messages, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return responseText(resp)
+}
+
+func (o *ollamaLLM) ChatResponse(ctx context.Context, messages []Message) (*Response, error) {
+	return o.complete(ctx, messages, nil, nil)
+}
+
+func (o *ollamaLLM) ChatWithTools(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	return o.complete(ctx, messages, tools, nil)
+}
+
+func (o *ollamaLLM) chatJSON(ctx context.Context, messages []Message, schema *Schema) (string, error) {
+	resp, err := o.complete(ctx, messages, nil, schema)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+func (o *ollamaLLM) StreamChat(ctx context.Context, messages []Message) <-chan StreamEvent {
+	if err := validateMessages(messages); err != nil {
+		return errorStream(err)
+	}
+
+	req, err := o.chatRequest(ctx, messages, true)
+	if err != nil {
+		return errorStream(err)
+	}
+
+	resp, err := o.send(ctx, "/api/chat", req)
+	if err != nil {
+		return errorStream(err)
+	}
+
+	events := make(chan StreamEvent)
+
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			var chunk ollamaResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("error al decodificar el streaming de Ollama: %w", err)})
+				return
+			}
+			if chunk.Error != "" {
+				sendEvent(ctx, events, StreamEvent{Done: true, Err: newHTTPAPIError(Ollama, 0, "", chunk.Error, line)})
+				return
+			}
+
+			if chunk.Message.Content != "" {
+				if !sendEvent(ctx, events, StreamEvent{Delta: chunk.Message.Content}) {
+					return
+				}
+			}
+
+			if chunk.Done {
+				sendEvent(ctx, events, StreamEvent{
+					Done:         true,
+					FinishReason: ollamaFinishReason(chunk.DoneReason),
+					Usage:        ollamaUsage(chunk),
+				})
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("error al leer el streaming de Ollama: %w", err)})
+			return
+		}
+		sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("el streaming de Ollama terminó sin el mensaje final")})
+	}()
+
+	return events
+}
+
+func (o *ollamaLLM) GenerateResponseAsync(ctx context.Context, prompt string, opts ...Option) (<-chan string, <-chan error) {
+	model, err := o.withOptions(opts)
+	if err != nil {
+		return streamToAsync(ctx, errorStream(err))
+	}
+	return streamToAsync(ctx, model.StreamChat(ctx, []Message{UserMessage(prompt)}))
+}
+
+// complete envía la conversación sin streaming y convierte la respuesta
+func (o *ollamaLLM) complete(ctx context.Context, messages []Message, tools []Tool, format *Schema) (*Response, error) {
+	if err := validateMessages(messages); err != nil {
+		return nil, err
+	}
+
+	req, err := o.chatRequest(ctx, messages, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, tool := range tools {
+		t := ollamaTool{Type: "function"}
+		t.Function.Name = tool.Name
+		t.Function.Description = tool.Description
+		t.Function.Parameters = tool.Parameters
+		if t.Function.Parameters == nil {
+			t.Function.Parameters = &Schema{Type: SchemaObject}
+		}
+		req.Tools = append(req.Tools, t)
+	}
+	if format != nil {
+		req.Format = format
+	}
+
+	start := time.Now()
+	resp, err := o.send(ctx, "/api/chat", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error al decodificar la respuesta: %w", err)
+	}
+
+	response := &Response{
+		Content:      result.Message.Content,
+		FinishReason: ollamaFinishReason(result.DoneReason),
+		Model:        result.Model,
+		Usage:        *ollamaUsage(result),
+	}
+	for i, call := range result.Message.ToolCalls {
+		response.ToolCalls = append(response.ToolCalls, ToolCall{
+			// Ollama no asigna identificadores a las llamadas
+			ID:        fmt.Sprintf("call_%d", i),
+			Name:      call.Function.Name,
+			Arguments: string(call.Function.Arguments),
+		})
+	}
+	if len(response.ToolCalls) > 0 {
+		response.FinishReason = FinishReasonToolCalls
+	}
+
+	return finishResponse(response, o.config, start), nil
+}
+
+// chatRequest construye la petición a /api/chat a partir de la conversación
+func (o *ollamaLLM) chatRequest(ctx context.Context, messages []Message, stream bool) (ollamaRequest, error) {
+	req := ollamaRequest{
+		Model:   o.config.ModelName,
+		Stream:  stream,
+		Options: map[string]interface{}{"temperature": o.config.Temperature},
+	}
+	if o.config.MaxTokens > 0 {
+		req.Options["num_predict"] = o.config.MaxTokens
+	}
+	if o.config.TopP != 0 {
+		req.Options["top_p"] = o.config.TopP
+	}
+	if o.config.TopK != 0 {
+		req.Options["top_k"] = o.config.TopK
+	}
+	if len(o.config.StopSequences) > 0 {
+		req.Options["stop"] = o.config.StopSequences
+	}
+	if o.config.PresencePenalty != 0 {
+		req.Options["presence_penalty"] = o.config.PresencePenalty
+	}
+	if o.config.FrequencyPenalty != 0 {
+		req.Options["frequency_penalty"] = o.config.FrequencyPenalty
+	}
+	if o.config.Seed != nil {
+		req.Options["seed"] = *o.config.Seed
+	}
+
+	for _, msg := range messages {
+		m := ollamaMessage{Role: string(msg.Role), Content: msg.Content}
+		for _, img := range msg.Images {
+			data, _, err := img.load(ctx, o.config.Transport)
+			if err != nil {
+				return ollamaRequest{}, err
+			}
+			m.Images = append(m.Images, base64.StdEncoding.EncodeToString(data))
+		}
+		for _, call := range msg.ToolCalls {
+			var c ollamaToolCall
+			c.Function.Name = call.Name
+			c.Function.Arguments = json.RawMessage(call.Arguments)
+			if len(c.Function.Arguments) == 0 {
+				c.Function.Arguments = json.RawMessage("{}")
+			}
+			if !json.Valid(c.Function.Arguments) {
+				return ollamaRequest{}, fmt.Errorf("argumentos no válidos en la llamada a %s", call.Name)
+			}
+			m.ToolCalls = append(m.ToolCalls, c)
+		}
+		req.Messages = append(req.Messages, m)
+	}
+
+	return req, nil
+}
+
+// send realiza la petición al servidor de Ollama y comprueba el código de estado
+func (o *ollamaLLM) send(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	return ollamaPost(ctx, o.client, o.baseURL+path, body)
+}
+
+func ollamaPost(ctx context.Context, client *http.Client, url string, body interface{}) (*http.Response, error) {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el cuerpo de la solicitud: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error al crear la solicitud: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al hacer la solicitud: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error al leer la respuesta: %w", err)
+		}
+		var payload struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(body, &payload)
+		return nil, newHTTPAPIError(Ollama, resp.StatusCode, "", payload.Error, body)
+	}
+
+	return resp, nil
+}
+
+func ollamaUsage(resp ollamaResponse) *Usage {
+	return &Usage{
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+		TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+	}
+}
+
+// ollamaFinishReason traduce el motivo de finalización de Ollama al formato común
+func ollamaFinishReason(reason string) FinishReason {
+	switch reason {
+	case "stop", "":
+		return FinishReasonStop
+	case "length":
+		return FinishReasonLength
+	default:
+		return FinishReasonOther
+	}
+}
+
+type ollamaEmbedder struct {
+	*embedderDimensions
+	client  *http.Client
+	config  EmbedderConfig
+	baseURL string
+}
+
+func newOllamaEmbedder(cfg EmbedderConfig) (Embedder, error) {
+	if cfg.ModelName == "" {
+		return nil, fmt.Errorf("el embedder de Ollama requiere ModelName")
+	}
+
+	return &ollamaEmbedder{
+		embedderDimensions: newEmbedderDimensions(cfg),
+		client:             newHTTPClient(cfg.Transport, cfg.Headers, newRetryPolicy(cfg.MaxAttempts, cfg.MaxElapsedTime)),
+		config:             cfg,
+		baseURL:            ollamaBaseURLFor(cfg.BaseURL),
+	}, nil
+}
+
+// Embed genera los embeddings de uno en uno, ya que /api/embeddings no admite lotes
+func (o *ollamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		resp, err := ollamaPost(ctx, o.client, o.baseURL+"/api/embeddings", map[string]string{
+			"model":  o.config.ModelName,
+			"prompt": text,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Embedding []float64 `json:"embedding"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error al decodificar la respuesta: %w", err)
+		}
+		vectors[i] = result.Embedding
+	}
+
+	if err := o.observe(vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
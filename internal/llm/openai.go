@@ -2,62 +2,335 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/sashabaranov/go-openai"
 )
 
+// openAIParams son los parámetros de generación que admite la API de OpenAI
+const openAIParams = paramTopP | paramStopSequences | paramPresencePenalty | paramFrequencyPenalty | paramSeed | paramCandidateCount
+
 type openAILLM struct {
 	client *openai.Client
 	config Config
 }
 
 func newOpenAI(cfg Config) (LLM, error) {
-	client := openai.NewClient(cfg.APIKey)
+	if err := checkParams(cfg, openAIParams); err != nil {
+		return nil, err
+	}
+
+	httpClient := newHTTPClient(cfg.Transport, cfg.Headers, newRetryPolicy(cfg.MaxAttempts, cfg.MaxElapsedTime))
+	client := openai.NewClientWithConfig(openAIClientConfig(cfg.APIKey, cfg.BaseURL, cfg.Organization, httpClient))
 	return &openAILLM{
 		client: client,
 		config: cfg,
 	}, nil
 }
 
-func (o *openAILLM) GenerateResponse(ctx context.Context, prompt string) (string, error) {
-	resp, err := o.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: o.config.ModelName,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			MaxTokens:   o.config.MaxTokens,
-			Temperature: float32(o.config.Temperature),
+func (o *openAILLM) configuration() Config {
+	return o.config
+}
+
+func (o *openAILLM) GenerateResponse(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	model, err := o.withOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	return model.Chat(ctx, []Message{UserMessage(prompt)})
+}
+
+// withOptions devuelve una copia que comparte el cliente pero usa la configuración con las opciones aplicadas
+func (o *openAILLM) withOptions(opts []Option) (*openAILLM, error) {
+	if len(opts) == 0 {
+		return o, nil
+	}
+	cfg := applyOptions(o.config, opts)
+	if err := checkParams(cfg, openAIParams); err != nil {
+		return nil, err
+	}
+	return &openAILLM{client: o.client, config: cfg}, nil
+}
+
+func (o *openAILLM) Chat(ctx context.Context, messages []Message) (string, error) {
+	resp, err := o.complete(ctx, messages, nil)
+	if err != nil {
+		return "", err
+	}
+	return responseText(resp)
+}
+
+func (o *openAILLM) ChatResponse(ctx context.Context, messages []Message) (*Response, error) {
+	return o.complete(ctx, messages, nil)
+}
+
+func (o *openAILLM) ChatWithTools(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	return o.complete(ctx, messages, tools)
+}
+
+// nativeJSON solo usa json_schema con la API de OpenAI: los servidores
+// compatibles no siempre lo admiten
+func (o *openAILLM) nativeJSON(schema *Schema) bool {
+	return o.config.Provider == OpenAI && schema.closed()
+}
+
+func (o *openAILLM) chatJSON(ctx context.Context, messages []Message, schema *Schema) (string, error) {
+	if err := validateMessages(messages); err != nil {
+		return "", err
+	}
+
+	req, err := o.chatRequest(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   "response",
+			Schema: schema.toOpenAI(),
 		},
-	)
+	}
 
+	resp, err := o.client.CreateChatCompletion(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("error generando respuesta de OpenAI: %w", err)
+		return "", fmt.Errorf("error generando respuesta de OpenAI: %w", wrapOpenAIError(o.config.Provider, err))
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no se generaron opciones")
 	}
 
 	return resp.Choices[0].Message.Content, nil
 }
 
-func (o *openAILLM) GenerateResponseAsync(ctx context.Context, prompt string) (<-chan string, <-chan error) {
-	respChan := make(chan string)
-	errChan := make(chan error)
+// complete envía la conversación y convierte la primera opción en una Response
+func (o *openAILLM) complete(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	if err := validateMessages(messages); err != nil {
+		return nil, err
+	}
+
+	req, err := o.chatRequest(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	for _, tool := range tools {
+		req.Tools = append(req.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters.toOpenAI(),
+			},
+		})
+	}
+
+	start := time.Now()
+	resp, err := o.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("error generando respuesta de OpenAI: %w", wrapOpenAIError(o.config.Provider, err))
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no se generaron opciones")
+	}
+
+	choice := resp.Choices[0]
+	result := &Response{
+		Content:      choice.Message.Content,
+		FinishReason: openAIFinishReason(choice.FinishReason),
+		Model:        resp.Model,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}
+	if len(resp.Choices) > 1 {
+		for _, c := range resp.Choices {
+			result.Candidates = append(result.Candidates, c.Message.Content)
+		}
+	}
+	for _, call := range choice.Message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
+	return finishResponse(result, o.config, start), nil
+}
+
+func (o *openAILLM) StreamChat(ctx context.Context, messages []Message) <-chan StreamEvent {
+	if err := validateMessages(messages); err != nil {
+		return errorStream(err)
+	}
+
+	req, err := o.chatRequest(ctx, messages)
+	if err != nil {
+		return errorStream(err)
+	}
+	req.Stream = true
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := o.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return errorStream(fmt.Errorf("error iniciando el streaming de OpenAI: %w", wrapOpenAIError(o.config.Provider, err)))
+	}
+
+	events := make(chan StreamEvent)
 
 	go func() {
-		defer close(respChan)
-		defer close(errChan)
+		defer close(events)
+		defer stream.Close()
 
-		resp, err := o.GenerateResponse(ctx, prompt)
-		if err != nil {
-			errChan <- err
-			return
+		final := StreamEvent{Done: true}
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				sendEvent(ctx, events, StreamEvent{Done: true, Err: fmt.Errorf("error recibiendo el streaming de OpenAI: %w", wrapOpenAIError(o.config.Provider, err))})
+				return
+			}
+
+			if chunk.Usage != nil {
+				final.Usage = &Usage{
+					PromptTokens:     chunk.Usage.PromptTokens,
+					CompletionTokens: chunk.Usage.CompletionTokens,
+					TotalTokens:      chunk.Usage.TotalTokens,
+				}
+			}
+
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+
+			// Con CandidateCount > 1 solo se emite la primera alternativa
+			choice := chunk.Choices[0]
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.FinishReason != "" {
+				final.FinishReason = openAIFinishReason(choice.FinishReason)
+			}
+			if choice.Delta.Content != "" {
+				if !sendEvent(ctx, events, StreamEvent{Delta: choice.Delta.Content}) {
+					return
+				}
+			}
 		}
 
-		respChan <- resp
+		sendEvent(ctx, events, final)
 	}()
 
-	return respChan, errChan
+	return events
+}
+
+func (o *openAILLM) GenerateResponseAsync(ctx context.Context, prompt string, opts ...Option) (<-chan string, <-chan error) {
+	model, err := o.withOptions(opts)
+	if err != nil {
+		return streamToAsync(ctx, errorStream(err))
+	}
+	return streamToAsync(ctx, model.StreamChat(ctx, []Message{UserMessage(prompt)}))
+}
+
+// openAIClientConfig construye la configuración del cliente respetando la URL base y la organización
+func openAIClientConfig(apiKey, baseURL, organization string, httpClient *http.Client) openai.ClientConfig {
+	clientConfig := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		clientConfig.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+	clientConfig.OrgID = organization
+	clientConfig.HTTPClient = httpClient
+	return clientConfig
+}
+
+// chatRequest construye la petición de chat a partir de la conversación
+func (o *openAILLM) chatRequest(ctx context.Context, messages []Message) (openai.ChatCompletionRequest, error) {
+	chatMessages := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		chatMessages[i] = openai.ChatCompletionMessage{
+			Role:       string(msg.Role),
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+		if len(msg.Images) > 0 {
+			parts, err := o.imageParts(ctx, msg)
+			if err != nil {
+				return openai.ChatCompletionRequest{}, err
+			}
+			chatMessages[i].Content = ""
+			chatMessages[i].MultiContent = parts
+		}
+		for _, call := range msg.ToolCalls {
+			chatMessages[i].ToolCalls = append(chatMessages[i].ToolCalls, openai.ToolCall{
+				ID:   call.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			})
+		}
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:            o.config.ModelName,
+		Messages:         chatMessages,
+		MaxTokens:        o.config.MaxTokens,
+		Temperature:      float32(o.config.Temperature),
+		TopP:             float32(o.config.TopP),
+		Stop:             o.config.StopSequences,
+		PresencePenalty:  float32(o.config.PresencePenalty),
+		FrequencyPenalty: float32(o.config.FrequencyPenalty),
+		Seed:             o.config.Seed,
+		N:                o.config.CandidateCount,
+	}, nil
+}
+
+// imageParts convierte el texto y las imágenes de un mensaje en partes de
+// contenido. Las imágenes con URL se envían tal cual y el resto como URL data:.
+func (o *openAILLM) imageParts(ctx context.Context, msg Message) ([]openai.ChatMessagePart, error) {
+	var parts []openai.ChatMessagePart
+	if msg.Content != "" {
+		parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: msg.Content})
+	}
+	for _, img := range msg.Images {
+		url := img.URL
+		if url == "" {
+			var err error
+			url, err = img.dataURL(ctx, o.config.Transport)
+			if err != nil {
+				return nil, err
+			}
+		}
+		parts = append(parts, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: url, Detail: openai.ImageURLDetailAuto},
+		})
+	}
+	return parts, nil
+}
+
+// openAIFinishReason traduce el motivo de finalización de OpenAI al formato común
+func openAIFinishReason(reason openai.FinishReason) FinishReason {
+	switch reason {
+	case openai.FinishReasonStop:
+		return FinishReasonStop
+	case openai.FinishReasonLength:
+		return FinishReasonLength
+	case openai.FinishReasonContentFilter:
+		return FinishReasonContentFilter
+	case openai.FinishReasonToolCalls, openai.FinishReasonFunctionCall:
+		return FinishReasonToolCalls
+	default:
+		return FinishReasonOther
+	}
 }
@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Price es el coste en dólares por millón de tokens de un modelo
+type Price struct {
+	PromptPerMillion     float64
+	CompletionPerMillion float64
+}
+
+// PriceTable asocia nombres de modelo con su precio. Un nombre también sirve
+// como prefijo de las versiones fechadas del modelo (gpt-4o cubre gpt-4o-2024-08-06).
+type PriceTable map[string]Price
+
+// DefaultPrices contiene los precios públicos de los modelos más habituales.
+// Los precios cambian con frecuencia, así que conviene pasar una tabla propia
+// en Config.Prices cuando se necesite un cálculo exacto.
+var DefaultPrices = PriceTable{
+	"gpt-4o":                 {PromptPerMillion: 2.5, CompletionPerMillion: 10},
+	"gpt-4o-mini":            {PromptPerMillion: 0.15, CompletionPerMillion: 0.6},
+	"gpt-4-turbo":            {PromptPerMillion: 10, CompletionPerMillion: 30},
+	"gpt-3.5-turbo":          {PromptPerMillion: 0.5, CompletionPerMillion: 1.5},
+	"claude-3-5-sonnet":      {PromptPerMillion: 3, CompletionPerMillion: 15},
+	"claude-3-opus":          {PromptPerMillion: 15, CompletionPerMillion: 75},
+	"claude-3-sonnet":        {PromptPerMillion: 3, CompletionPerMillion: 15},
+	"claude-3-haiku":         {PromptPerMillion: 0.25, CompletionPerMillion: 1.25},
+	"gemini-1.5-pro":         {PromptPerMillion: 1.25, CompletionPerMillion: 5},
+	"gemini-1.5-flash":       {PromptPerMillion: 0.075, CompletionPerMillion: 0.3},
+	"gemini-1.0-pro":         {PromptPerMillion: 0.5, CompletionPerMillion: 1.5},
+	"text-embedding-3-small": {PromptPerMillion: 0.02},
+	"text-embedding-3-large": {PromptPerMillion: 0.13},
+	"text-embedding-ada-002": {PromptPerMillion: 0.1},
+}
+
+// Lookup devuelve el precio de un modelo, buscando primero el nombre exacto y
+// después el prefijo más largo que coincida
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+
+	best := ""
+	for name := range t {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return t[best], true
+}
+
+// Cost calcula el coste en dólares de un consumo de tokens. Devuelve false si
+// el modelo no está en la tabla.
+func (t PriceTable) Cost(model string, usage Usage) (float64, bool) {
+	price, ok := t.Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*price.PromptPerMillion +
+		float64(usage.CompletionTokens)*price.CompletionPerMillion) / 1e6, true
+}
+
+// finishResponse completa los datos comunes de una respuesta: modelo, latencia y coste
+func finishResponse(resp *Response, cfg Config, start time.Time) *Response {
+	resp.Latency = time.Since(start)
+	if resp.Model == "" {
+		resp.Model = cfg.ModelName
+	}
+	if resp.Usage.TotalTokens == 0 {
+		resp.Usage.TotalTokens = resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+	}
+
+	prices := cfg.Prices
+	if prices == nil {
+		prices = DefaultPrices
+	}
+	resp.Cost, _ = prices.Cost(resp.Model, resp.Usage)
+	return resp
+}
+
+// Spend resume el consumo acumulado de un conjunto de llamadas
+type Spend struct {
+	Calls            int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	Latency          time.Duration
+}
+
+// CostTracker acumula el consumo de las respuestas agrupado por funcionalidad.
+// Es seguro para uso concurrente.
+type CostTracker struct {
+	mu       sync.Mutex
+	features map[string]*Spend
+}
+
+// NewCostTracker crea un acumulador de costes vacío
+func NewCostTracker() *CostTracker {
+	return &CostTracker{features: make(map[string]*Spend)}
+}
+
+// Record suma una respuesta al consumo de la funcionalidad indicada
+func (t *CostTracker) Record(feature string, resp *Response) {
+	if resp == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spend, ok := t.features[feature]
+	if !ok {
+		spend = &Spend{}
+		t.features[feature] = spend
+	}
+	spend.Calls++
+	spend.PromptTokens += resp.Usage.PromptTokens
+	spend.CompletionTokens += resp.Usage.CompletionTokens
+	spend.Cost += resp.Cost
+	spend.Latency += resp.Latency
+}
+
+// Feature devuelve el consumo acumulado de una funcionalidad
+func (t *CostTracker) Feature(feature string) Spend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if spend, ok := t.features[feature]; ok {
+		return *spend
+	}
+	return Spend{}
+}
+
+// Features devuelve los nombres de las funcionalidades registradas, ordenados
+func (t *CostTracker) Features() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	names := make([]string, 0, len(t.features))
+	for name := range t.features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Total devuelve el consumo acumulado de todas las funcionalidades
+func (t *CostTracker) Total() Spend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var total Spend
+	for _, spend := range t.features {
+		total.Calls += spend.Calls
+		total.PromptTokens += spend.PromptTokens
+		total.CompletionTokens += spend.CompletionTokens
+		total.Cost += spend.Cost
+		total.Latency += spend.Latency
+	}
+	return total
+}
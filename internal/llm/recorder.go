@@ -0,0 +1,266 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// RecorderMode indica si un Recorder graba peticiones reales o reproduce las grabadas
+type RecorderMode int
+
+const (
+	// RecordIfMissing reproduce el archivo si existe y graba uno nuevo si no
+	RecordIfMissing RecorderMode = iota
+	// RecordAlways hace siempre las peticiones reales y sobrescribe el archivo
+	RecordAlways
+	// ReplayOnly reproduce el archivo y falla ante cualquier petición no grabada
+	ReplayOnly
+)
+
+const redacted = "REDACTED"
+
+// sensitiveHeaders son las cabeceras que llevan credenciales en los proveedores soportados
+var sensitiveHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key", "Api-Key", "Openai-Organization", "Cookie", "Set-Cookie"}
+
+// sensitiveQueryParams son los parámetros de la URL que llevan credenciales
+var sensitiveQueryParams = []string{"key", "api_key"}
+
+// Interaction es un intercambio HTTP grabado en un cassette
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest es la petición de una interacción, con las credenciales borradas
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+}
+
+// RecordedResponse es la respuesta de una interacción
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body"`
+}
+
+// Recorder es un http.RoundTripper que graba las peticiones a los proveedores
+// en un archivo JSON (cassette) y las reproduce después sin conexión. Se pasa
+// en Config.Transport o EmbedderConfig.Transport. Las credenciales se borran
+// antes de escribir el archivo, y al reproducir cada petición debe coincidir
+// en método, URL y cuerpo con una interacción grabada.
+type Recorder struct {
+	mu           sync.Mutex
+	path         string
+	mode         RecorderMode
+	recording    bool
+	base         http.RoundTripper
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder crea un Recorder sobre el archivo indicado. base es el transporte
+// para las peticiones reales (http.DefaultTransport si es nil).
+func NewRecorder(path string, mode RecorderMode, base http.RoundTripper) (*Recorder, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	r := &Recorder{path: path, mode: mode, base: base}
+
+	if mode == RecordAlways {
+		r.recording = true
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && mode == RecordIfMissing {
+		r.recording = true
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el cassette: %w", err)
+	}
+
+	var cassette struct {
+		Interactions []Interaction `json:"interactions"`
+	}
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("error al decodificar el cassette %s: %w", path, err)
+	}
+	r.interactions = cassette.Interactions
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// Recording indica si el Recorder está grabando peticiones reales
+func (r *Recorder) Recording() bool {
+	return r.recording
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded := RecordedRequest{
+		Method:  req.Method,
+		URL:     scrubURL(req.URL),
+		Headers: scrubHeaders(req.Header),
+		Body:    string(body),
+	}
+
+	if r.recording {
+		return r.record(req, recorded)
+	}
+	return r.replay(req, recorded)
+}
+
+// record hace la petición real y añade la interacción al cassette
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la respuesta: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.interactions = append(r.interactions, Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    scrubHeaders(resp.Header),
+			Body:       string(body),
+		},
+	})
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// replay devuelve la primera interacción no usada que coincide con la petición
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.interactions {
+		if r.used[i] || !matchRequest(interaction.Request, recorded) {
+			continue
+		}
+		r.used[i] = true
+
+		resp := interaction.Response
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode:    resp.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        resp.Headers.Clone(),
+			Body:          io.NopCloser(strings.NewReader(resp.Body)),
+			ContentLength: int64(len(resp.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no hay ninguna interacción grabada en %s para %s %s", r.path, recorded.Method, recorded.URL)
+}
+
+// save escribe el cassette completo en disco
+func (r *Recorder) save() error {
+	cassette := struct {
+		Interactions []Interaction `json:"interactions"`
+	}{Interactions: r.interactions}
+
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error al codificar el cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("error al crear el directorio del cassette: %w", err)
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("error al escribir el cassette: %w", err)
+	}
+	return nil
+}
+
+// readRequestBody lee el cuerpo de la petición y lo deja disponible para el transporte real
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el cuerpo de la petición: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// matchRequest compara método, URL y cuerpo; los cuerpos JSON se comparan por
+// contenido para que no influyan el orden de las claves ni los espacios
+func matchRequest(recorded, req RecordedRequest) bool {
+	if recorded.Method != req.Method || recorded.URL != req.URL {
+		return false
+	}
+	if recorded.Body == req.Body {
+		return true
+	}
+
+	var a, b interface{}
+	if json.Unmarshal([]byte(recorded.Body), &a) != nil || json.Unmarshal([]byte(req.Body), &b) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+func scrubHeaders(headers http.Header) http.Header {
+	scrubbed := headers.Clone()
+	if scrubbed == nil {
+		scrubbed = http.Header{}
+	}
+	for _, name := range sensitiveHeaders {
+		if scrubbed.Get(name) != "" {
+			scrubbed.Set(name, redacted)
+		}
+	}
+	return scrubbed
+}
+
+func scrubURL(u *url.URL) string {
+	scrubbed := *u
+	query := scrubbed.Query()
+	changed := false
+	for _, name := range sensitiveQueryParams {
+		if query.Has(name) {
+			query.Set(name, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		scrubbed.RawQuery = query.Encode()
+	}
+	return scrubbed.String()
+}
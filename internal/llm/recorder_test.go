@@ -0,0 +1,264 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Los cassettes de testdata se reproducen sin conexión. Para volver a
+// grabarlos contra los proveedores reales se ejecutan los tests con
+// LLM_RECORD=1 y las claves en OPENAI_API_KEY, ANTHROPIC_API_KEY y
+// GEMINI_API_KEY (y un servidor de Ollama en local).
+
+// replayProvider es un proveedor cuyas peticiones se comprueban contra los cassettes
+type replayProvider struct {
+	name   string
+	config Config
+	keyEnv string
+}
+
+var replayProviders = []replayProvider{
+	{"openai", Config{Provider: OpenAI, ModelName: "gpt-4o-mini", MaxTokens: 200}, "OPENAI_API_KEY"},
+	{"anthropic", Config{Provider: Anthropic, ModelName: "claude-3-5-haiku-20241022", MaxTokens: 200}, "ANTHROPIC_API_KEY"},
+	{"gemini", Config{Provider: Gemini, ModelName: "gemini-1.5-flash", MaxTokens: 200}, "GEMINI_API_KEY"},
+	{"ollama", Config{Provider: Ollama, ModelName: "llama3.1"}, ""},
+}
+
+// cassette abre testdata/<name>.json para reproducirlo, o para grabarlo de
+// nuevo si LLM_RECORD está definida
+func cassette(t *testing.T, name string) *Recorder {
+	t.Helper()
+	mode := ReplayOnly
+	if os.Getenv("LLM_RECORD") != "" {
+		mode = RecordAlways
+	}
+	recorder, err := NewRecorder(filepath.Join("testdata", name+".json"), mode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder
+}
+
+// replayKey devuelve la clave real al grabar y una ficticia al reproducir
+func replayKey(recorder *Recorder, env string) string {
+	if recorder.Recording() && env != "" {
+		return os.Getenv(env)
+	}
+	return "test-key"
+}
+
+// replayModel crea el modelo del proveedor sobre el cassette del escenario
+func replayModel(t *testing.T, p replayProvider, scenario string) LLM {
+	t.Helper()
+	recorder := cassette(t, p.name+"_"+scenario)
+	cfg := p.config
+	cfg.APIKey = replayKey(recorder, p.keyEnv)
+	cfg.Transport = recorder
+	model, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
+
+func TestReplayChat(t *testing.T) {
+	for _, p := range replayProviders {
+		t.Run(p.name, func(t *testing.T) {
+			model := replayModel(t, p, "chat")
+
+			resp, err := model.ChatResponse(context.Background(), []Message{
+				SystemMessage("Responde en una sola frase."),
+				UserMessage("¿Cuál es la capital de Francia?"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(resp.Content, "París") {
+				t.Errorf("contenido inesperado: %q", resp.Content)
+			}
+			if resp.FinishReason != FinishReasonStop {
+				t.Errorf("motivo de finalización inesperado: %q", resp.FinishReason)
+			}
+			if resp.Usage.PromptTokens == 0 || resp.Usage.CompletionTokens == 0 || resp.Usage.TotalTokens < resp.Usage.PromptTokens+resp.Usage.CompletionTokens {
+				t.Errorf("uso de tokens inesperado: %+v", resp.Usage)
+			}
+		})
+	}
+}
+
+func TestReplayToolCalls(t *testing.T) {
+	tools := []Tool{{
+		Name:        "clima",
+		Description: "Devuelve el tiempo actual en una ciudad",
+		Parameters: &Schema{
+			Type:       SchemaObject,
+			Properties: map[string]*Schema{"ciudad": {Type: SchemaString}},
+			Required:   []string{"ciudad"},
+		},
+	}}
+
+	for _, p := range replayProviders {
+		t.Run(p.name, func(t *testing.T) {
+			model := replayModel(t, p, "tools")
+			ctx := context.Background()
+
+			messages := []Message{UserMessage("¿Qué tiempo hace en Madrid?")}
+			resp, err := model.ChatWithTools(ctx, messages, tools)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.FinishReason != FinishReasonToolCalls || len(resp.ToolCalls) != 1 {
+				t.Fatalf("se esperaba una llamada a herramienta: %+v", resp)
+			}
+			call := resp.ToolCalls[0]
+			var args struct {
+				Ciudad string `json:"ciudad"`
+			}
+			if call.ID == "" || call.Name != "clima" || json.Unmarshal([]byte(call.Arguments), &args) != nil || args.Ciudad != "Madrid" {
+				t.Fatalf("llamada inesperada: %+v", call)
+			}
+
+			// El segundo turno comprueba cómo se envían la llamada y su resultado
+			messages = append(messages, Message{Role: RoleAssistant, Content: resp.Content, ToolCalls: resp.ToolCalls}, ToolMessage(call, `{"cielo":"soleado","temperatura":24}`))
+			resp, err = model.ChatWithTools(ctx, messages, tools)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.ToolCalls) != 0 || !strings.Contains(resp.Content, "24") {
+				t.Errorf("respuesta final inesperada: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestReplayStream(t *testing.T) {
+	for _, p := range replayProviders {
+		t.Run(p.name, func(t *testing.T) {
+			model := replayModel(t, p, "stream")
+
+			var text strings.Builder
+			var final StreamEvent
+			deltas := 0
+			for event := range model.StreamChat(context.Background(), []Message{UserMessage("Cuenta del 1 al 5 separando con comas.")}) {
+				if event.Done {
+					final = event
+					continue
+				}
+				text.WriteString(event.Delta)
+				deltas++
+			}
+
+			if final.Err != nil {
+				t.Fatal(final.Err)
+			}
+			if deltas < 2 || !strings.Contains(text.String(), "1, 2, 3, 4") {
+				t.Errorf("texto inesperado en %d fragmentos: %q", deltas, text.String())
+			}
+			if final.FinishReason != FinishReasonStop || final.Usage == nil || final.Usage.CompletionTokens == 0 {
+				t.Errorf("evento final inesperado: %+v", final)
+			}
+		})
+	}
+}
+
+func TestReplayEmbeddings(t *testing.T) {
+	providers := []struct {
+		name   string
+		config EmbedderConfig
+		keyEnv string
+	}{
+		{"openai", EmbedderConfig{Provider: OpenAI, ModelName: "text-embedding-3-small", Dimensions: 8}, "OPENAI_API_KEY"},
+		{"gemini", EmbedderConfig{Provider: Gemini, ModelName: "text-embedding-004", Dimensions: 8}, "GEMINI_API_KEY"},
+		{"ollama", EmbedderConfig{Provider: Ollama, ModelName: "nomic-embed-text"}, ""},
+	}
+
+	for _, p := range providers {
+		t.Run(p.name, func(t *testing.T) {
+			recorder := cassette(t, p.name+"_embeddings")
+			cfg := p.config
+			cfg.APIKey = replayKey(recorder, p.keyEnv)
+			cfg.Transport = recorder
+			embedder, err := NewEmbedder(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			vectors, err := embedder.Embed(context.Background(), []string{"hola", "adiós"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(vectors) != 2 || len(vectors[0]) == 0 || len(vectors[0]) != len(vectors[1]) {
+				t.Fatalf("vectores inesperados: %v", vectors)
+			}
+			if embedder.Dimensions() != len(vectors[0]) {
+				t.Errorf("Dimensions() = %d, los vectores tienen %d", embedder.Dimensions(), len(vectors[0]))
+			}
+		})
+	}
+}
+
+func TestRecorderScrubsCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "sesion=secreta")
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := NewRecorder(path, RecordIfMissing, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recorder.Recording() {
+		t.Fatal("sin cassette RecordIfMissing debe grabar")
+	}
+
+	req, _ := http.NewRequest("POST", server.URL+"/v1/chat?key=secreta&alt=json", strings.NewReader(`{"a":1,"b":2}`))
+	req.Header.Set("Authorization", "Bearer secreta")
+	req.Header.Set("X-Goog-Api-Key", "secreta")
+	resp, err := recorder.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secreta") {
+		t.Errorf("el cassette contiene credenciales:\n%s", data)
+	}
+
+	// Al reproducir, el cuerpo JSON se compara por contenido y no por texto
+	replayer, err := NewRecorder(path, RecordIfMissing, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayer.Recording() {
+		t.Fatal("con cassette RecordIfMissing debe reproducir")
+	}
+	req, _ = http.NewRequest("POST", server.URL+"/v1/chat?key=otra&alt=json", strings.NewReader(`{ "b": 2, "a": 1 }`))
+	resp, err = replayer.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != `{"ok":true}` {
+		t.Errorf("respuesta reproducida inesperada: %d %s", resp.StatusCode, body)
+	}
+
+	// Cada interacción se reproduce una sola vez
+	req, _ = http.NewRequest("POST", server.URL+"/v1/chat?key=otra&alt=json", strings.NewReader(`{"a":1,"b":2}`))
+	if _, err := replayer.RoundTrip(req); err == nil {
+		t.Error("una interacción ya usada no debe reproducirse otra vez")
+	}
+}
@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultMaxElapsedTime = 2 * time.Minute
+	retryInitialDelay     = 500 * time.Millisecond
+	retryMaxDelay         = 30 * time.Second
+	maxRetryBodyPeek      = 64 * 1024
+)
+
+// retryPolicy define cuántas veces y durante cuánto tiempo se reintenta una petición
+type retryPolicy struct {
+	maxAttempts    int
+	maxElapsedTime time.Duration
+}
+
+func newRetryPolicy(maxAttempts int, maxElapsedTime time.Duration) retryPolicy {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if maxElapsedTime <= 0 {
+		maxElapsedTime = defaultMaxElapsedTime
+	}
+	return retryPolicy{maxAttempts: maxAttempts, maxElapsedTime: maxElapsedTime}
+}
+
+// retryTransport reintenta las peticiones que fallan por limitación de tasa,
+// sobrecarga o errores de red, con backoff exponencial y jitter, respetando
+// la cabecera Retry-After cuando el servidor la envía
+type retryTransport struct {
+	policy retryPolicy
+	base   http.RoundTripper
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.Body != nil {
+			// El cuerpo se consumió en el intento anterior y hay que reconstruirlo
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if !shouldRetry(req.Context(), resp, err) || attempt >= t.policy.maxAttempts || !canRewind(req) {
+			return resp, err
+		}
+
+		delay := retryDelay(attempt, resp)
+		if time.Since(start)+delay > t.policy.maxElapsedTime {
+			return resp, err
+		}
+
+		if resp != nil {
+			// Se descarta la respuesta para poder reutilizar la conexión
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := t.sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// canRewind indica si el cuerpo de la petición se puede volver a enviar
+func canRewind(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// shouldRetry clasifica el resultado de un intento como reintentable o definitivo
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// Si el contexto se canceló no tiene sentido volver a intentarlo
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		return true
+	}
+	// Un 429 por cuota o saldo agotado no se resuelve esperando
+	if resp.StatusCode == http.StatusTooManyRequests && isQuotaResponse(resp) {
+		return false
+	}
+	return isRetryableStatus(resp.StatusCode)
+}
+
+// isQuotaResponse lee el principio del cuerpo de la respuesta para saber si
+// el error es de cuota agotada. El cuerpo se restaura para que el proveedor
+// pueda decodificar el error después.
+func isQuotaResponse(resp *http.Response) bool {
+	head, err := io.ReadAll(io.LimitReader(resp.Body, maxRetryBodyPeek))
+	resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(head), resp.Body), Closer: resp.Body}
+	return err == nil && looksLikeQuota(string(head))
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// isRetryableStatus indica si un código de estado HTTP corresponde a un error transitorio
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+		529: // Anthropic: API sobrecargada
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay calcula la espera antes del siguiente intento
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header); ok {
+			return delay
+		}
+	}
+
+	delay := retryInitialDelay << (attempt - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	// Jitter completo sobre la mitad superior del intervalo para repartir los reintentos
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter interpreta las cabeceras retry-after-ms y Retry-After (segundos o fecha HTTP)
+func parseRetryAfter(header http.Header) (time.Duration, bool) {
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if value, err := strconv.ParseFloat(ms, 64); err == nil && value >= 0 {
+			return time.Duration(value * float64(time.Millisecond)), true
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// sleepContext espera el tiempo indicado o hasta que se cancele el contexto
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedServer responde a cada petición con la respuesta de la posición
+// correspondiente, repitiendo la última, y cuenta las peticiones recibidas
+func scriptedServer(t *testing.T, responses ...func(w http.ResponseWriter)) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, _ := io.ReadAll(r.Body); string(body) != `{"prompt":"hola"}` {
+			t.Errorf("cuerpo inesperado en el intento %d: %q", atomic.LoadInt32(&calls)+1, body)
+		}
+		n := int(atomic.AddInt32(&calls, 1))
+		if n > len(responses) {
+			n = len(responses)
+		}
+		responses[n-1](w)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func status(code int, headers map[string]string, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for key, value := range headers {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(code)
+		io.WriteString(w, body)
+	}
+}
+
+// recordingTransport devuelve un retryTransport que anota las esperas en vez de dormir
+func recordingTransport(maxAttempts int) (*retryTransport, *[]time.Duration) {
+	var delays []time.Duration
+	return &retryTransport{
+		policy: newRetryPolicy(maxAttempts, time.Minute),
+		base:   http.DefaultTransport,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		},
+	}, &delays
+}
+
+func post(t *testing.T, ctx context.Context, transport http.RoundTripper, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(`{"prompt":"hola"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return (&http.Client{Transport: transport}).Do(req)
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	server, calls := scriptedServer(t,
+		status(http.StatusTooManyRequests, map[string]string{"Retry-After": "2"}, `{"error":{"type":"rate_limit_error"}}`),
+		status(http.StatusOK, nil, "ok"),
+	)
+	transport, delays := recordingTransport(3)
+
+	resp, err := post(t, context.Background(), transport, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || *calls != 2 {
+		t.Fatalf("estado %d tras %d peticiones", resp.StatusCode, *calls)
+	}
+	if len(*delays) != 1 || (*delays)[0] != 2*time.Second {
+		t.Errorf("esperas inesperadas: %v", *delays)
+	}
+}
+
+func TestRetryBacksOffExponentially(t *testing.T) {
+	server, calls := scriptedServer(t,
+		status(http.StatusServiceUnavailable, nil, ""),
+		status(529, nil, ""),
+		status(http.StatusOK, nil, "ok"),
+	)
+	transport, delays := recordingTransport(3)
+
+	resp, err := post(t, context.Background(), transport, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || *calls != 3 {
+		t.Fatalf("estado %d tras %d peticiones", resp.StatusCode, *calls)
+	}
+	if len(*delays) != 2 {
+		t.Fatalf("se esperaban 2 esperas, hubo %v", *delays)
+	}
+	for i, d := range *delays {
+		base := retryInitialDelay << i
+		if d < base/2 || d > base {
+			t.Errorf("espera %d fuera de [%v, %v]: %v", i, base/2, base, d)
+		}
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	server, calls := scriptedServer(t, status(http.StatusBadGateway, nil, "bad gateway"))
+	transport, _ := recordingTransport(2)
+
+	resp, err := post(t, context.Background(), transport, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusBadGateway || string(body) != "bad gateway" || *calls != 2 {
+		t.Errorf("estado %d, cuerpo %q tras %d peticiones", resp.StatusCode, body, *calls)
+	}
+}
+
+func TestRetrySkipsQuotaErrors(t *testing.T) {
+	quota := `{"error":{"message":"You exceeded your current quota, please check your plan and billing details.","type":"insufficient_quota","code":"insufficient_quota"}}`
+	server, calls := scriptedServer(t, status(http.StatusTooManyRequests, map[string]string{"Content-Type": "application/json"}, quota))
+	transport, delays := recordingTransport(3)
+
+	resp, err := post(t, context.Background(), transport, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if *calls != 1 || len(*delays) != 0 {
+		t.Errorf("la cuota agotada no se debe reintentar: %d peticiones, esperas %v", *calls, *delays)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != quota {
+		t.Errorf("el cuerpo debe llegar intacto al proveedor: %q", body)
+	}
+}
+
+func TestRetryQuotaErrorThroughProvider(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"type":"error","error":{"type":"rate_limit_error","message":"Your credit balance is too low to access the Anthropic API."}}`)
+	}))
+	defer server.Close()
+
+	model, err := New(Config{Provider: Anthropic, ModelName: "claude-3-5-sonnet-20240620", APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = model.Chat(context.Background(), []Message{UserMessage("Hola")})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("se esperaba ErrQuotaExceeded, se obtuvo %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("se esperaba 1 petición, hubo %d", calls)
+	}
+}
+
+func TestRetryStopsOnContextCancel(t *testing.T) {
+	server, calls := scriptedServer(t, status(http.StatusServiceUnavailable, map[string]string{"Retry-After": "30"}, ""))
+	transport := &retryTransport{policy: newRetryPolicy(5, time.Minute), base: http.DefaultTransport, sleep: sleepContext}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := post(t, ctx, transport, server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("se esperaba context.DeadlineExceeded, se obtuvo %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("la espera no se interrumpió al cancelar: %v", elapsed)
+	}
+	if *calls != 1 {
+		t.Errorf("se esperaba 1 petición, hubo %d", *calls)
+	}
+}
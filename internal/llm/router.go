@@ -0,0 +1,289 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+	"unicode/utf8"
+)
+
+// RoutingStrategy determina el orden en que un Router prueba sus backends
+type RoutingStrategy int
+
+const (
+	// RouteFallback prueba los backends en el orden en que se declararon
+	RouteFallback RoutingStrategy = iota
+	// RouteWeighted reparte la carga al azar según Weight; el resto de backends
+	// quedan como alternativa si el elegido falla
+	RouteWeighted
+)
+
+// Backend es una de las instancias de LLM entre las que reparte un Router.
+// MaxPromptTokens y Match restringen qué peticiones puede atender; Timeout
+// limita la duración de cada intento (incluido el streaming completo).
+type Backend struct {
+	Name            string
+	LLM             LLM
+	Weight          int
+	Timeout         time.Duration
+	MaxPromptTokens int
+	Match           func(messages []Message) bool
+}
+
+// Router es un LLM compuesto que enruta cada petición entre varios backends y
+// pasa al siguiente cuando uno falla o agota su tiempo. Las respuestas de
+// ChatResponse y ChatWithTools indican en Backend quién respondió; OnAttempt,
+// si se define, se llama tras cada intento con el nombre del backend y su error.
+type Router struct {
+	Strategy  RoutingStrategy
+	OnAttempt func(backend string, err error)
+
+	backends []Backend
+}
+
+// NewRouter crea un Router con los backends indicados
+func NewRouter(strategy RoutingStrategy, backends ...Backend) (*Router, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("el router necesita al menos un backend")
+	}
+	// Se copia la lista para no modificar la del llamador al asignar nombres
+	backends = append([]Backend(nil), backends...)
+	for i, backend := range backends {
+		if backend.LLM == nil {
+			return nil, fmt.Errorf("el backend %d no tiene LLM", i)
+		}
+		if backend.Name == "" {
+			backends[i].Name = fmt.Sprintf("backend-%d", i)
+		}
+		if backend.Weight < 0 {
+			return nil, fmt.Errorf("el backend %s tiene un peso negativo", backends[i].Name)
+		}
+	}
+	return &Router{Strategy: strategy, backends: backends}, nil
+}
+
+func (r *Router) GenerateResponse(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	var content string
+	_, err := r.route(ctx, []Message{UserMessage(prompt)}, func(ctx context.Context, model LLM) error {
+		var err error
+		content, err = model.GenerateResponse(ctx, prompt, opts...)
+		return err
+	})
+	return content, err
+}
+
+func (r *Router) GenerateResponseAsync(ctx context.Context, prompt string, opts ...Option) (<-chan string, <-chan error) {
+	return streamToAsync(ctx, r.stream(ctx, []Message{UserMessage(prompt)}, func(ctx context.Context, model LLM) <-chan StreamEvent {
+		respChan, errChan := model.GenerateResponseAsync(ctx, prompt, opts...)
+		return asyncToStream(ctx, respChan, errChan)
+	}))
+}
+
+func (r *Router) Chat(ctx context.Context, messages []Message) (string, error) {
+	var content string
+	_, err := r.route(ctx, messages, func(ctx context.Context, model LLM) error {
+		var err error
+		content, err = model.Chat(ctx, messages)
+		return err
+	})
+	return content, err
+}
+
+func (r *Router) ChatResponse(ctx context.Context, messages []Message) (*Response, error) {
+	var resp *Response
+	name, err := r.route(ctx, messages, func(ctx context.Context, model LLM) error {
+		var err error
+		resp, err = model.ChatResponse(ctx, messages)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Backend = name
+	return resp, nil
+}
+
+func (r *Router) ChatWithTools(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	var resp *Response
+	name, err := r.route(ctx, messages, func(ctx context.Context, model LLM) error {
+		var err error
+		resp, err = model.ChatWithTools(ctx, messages, tools)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Backend = name
+	return resp, nil
+}
+
+// StreamChat solo cambia de backend mientras no se haya emitido ningún
+// fragmento; un error a mitad de la respuesta se entrega tal cual
+func (r *Router) StreamChat(ctx context.Context, messages []Message) <-chan StreamEvent {
+	return r.stream(ctx, messages, func(ctx context.Context, model LLM) <-chan StreamEvent {
+		return model.StreamChat(ctx, messages)
+	})
+}
+
+// stream abre el stream de cada backend candidato hasta que uno emite su primer evento sin error
+func (r *Router) stream(ctx context.Context, messages []Message, open func(ctx context.Context, model LLM) <-chan StreamEvent) <-chan StreamEvent {
+	candidates, err := r.candidates(messages)
+	if err != nil {
+		return errorStream(err)
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+
+		var errs []error
+		for _, backend := range candidates {
+			attemptCtx, cancel := backendContext(ctx, backend)
+			stream := open(attemptCtx, backend.LLM)
+
+			first, ok := <-stream
+			if !ok || (first.Done && first.Err != nil) {
+				cancel()
+				if !ok {
+					first.Err = fmt.Errorf("el stream terminó sin eventos")
+				}
+				r.report(backend.Name, first.Err)
+				errs = append(errs, fmt.Errorf("backend %s: %w", backend.Name, first.Err))
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+
+			r.report(backend.Name, nil)
+			forwarded := sendEvent(ctx, events, first)
+			for event := range stream {
+				if forwarded {
+					forwarded = sendEvent(ctx, events, event)
+				}
+			}
+			cancel()
+			return
+		}
+
+		sendEvent(ctx, events, StreamEvent{Done: true, Err: allBackendsFailed(errs)})
+	}()
+
+	return events
+}
+
+// route ejecuta la llamada sobre los backends candidatos hasta que uno responde
+// y devuelve el nombre del que lo hizo
+func (r *Router) route(ctx context.Context, messages []Message, call func(ctx context.Context, model LLM) error) (string, error) {
+	candidates, err := r.candidates(messages)
+	if err != nil {
+		return "", err
+	}
+
+	var errs []error
+	for _, backend := range candidates {
+		attemptCtx, cancel := backendContext(ctx, backend)
+		err := call(attemptCtx, backend.LLM)
+		cancel()
+
+		r.report(backend.Name, err)
+		if err == nil {
+			return backend.Name, nil
+		}
+		errs = append(errs, fmt.Errorf("backend %s: %w", backend.Name, err))
+
+		// Si el llamante canceló la petición no tiene sentido probar otro backend
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return "", allBackendsFailed(errs)
+}
+
+// candidates devuelve los backends que admiten la petición en el orden en que se probarán
+func (r *Router) candidates(messages []Message) ([]Backend, error) {
+	tokens := estimateTokens(messages)
+
+	var eligible []Backend
+	for _, backend := range r.backends {
+		if backend.MaxPromptTokens > 0 && tokens > backend.MaxPromptTokens {
+			continue
+		}
+		if backend.Match != nil && !backend.Match(messages) {
+			continue
+		}
+		eligible = append(eligible, backend)
+	}
+	if len(eligible) == 0 {
+		return nil, fmt.Errorf("ningún backend admite la petición (%d tokens estimados)", tokens)
+	}
+
+	if r.Strategy == RouteWeighted {
+		eligible = weightedOrder(eligible)
+	}
+	return eligible, nil
+}
+
+func (r *Router) report(backend string, err error) {
+	if r.OnAttempt != nil {
+		r.OnAttempt(backend, err)
+	}
+}
+
+// weightedOrder ordena los backends con un sorteo ponderado sin reemplazo. Un
+// peso 0 cuenta como 1.
+func weightedOrder(backends []Backend) []Backend {
+	remaining := append([]Backend(nil), backends...)
+	ordered := make([]Backend, 0, len(backends))
+
+	for len(remaining) > 0 {
+		total := 0
+		for _, backend := range remaining {
+			total += backendWeight(backend)
+		}
+
+		pick := rand.Intn(total)
+		for i, backend := range remaining {
+			pick -= backendWeight(backend)
+			if pick < 0 {
+				ordered = append(ordered, backend)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return ordered
+}
+
+func backendWeight(backend Backend) int {
+	if backend.Weight == 0 {
+		return 1
+	}
+	return backend.Weight
+}
+
+// backendContext aplica el timeout del backend, si lo tiene
+func backendContext(ctx context.Context, backend Backend) (context.Context, context.CancelFunc) {
+	if backend.Timeout > 0 {
+		return context.WithTimeout(ctx, backend.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func allBackendsFailed(errs []error) error {
+	return fmt.Errorf("todos los backends fallaron: %w", errors.Join(errs...))
+}
+
+// estimateTokens aproxima el número de tokens de una conversación a razón de
+// unos cuatro caracteres por token
+func estimateTokens(messages []Message) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += utf8.RuneCountInString(msg.Content)/4 + 4
+	}
+	return tokens
+}
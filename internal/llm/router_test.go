@@ -0,0 +1,23 @@
+package llm
+
+import "testing"
+
+func TestNewRouterDoesNotModifyBackends(t *testing.T) {
+	model, err := NewMock(MockConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := []Backend{{LLM: model}, {Name: "principal", LLM: model}}
+
+	router, err := NewRouter(RouteFallback, backends...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if backends[0].Name != "" {
+		t.Errorf("NewRouter cambió el nombre en la lista del llamador: %q", backends[0].Name)
+	}
+	if router.backends[0].Name != "backend-0" || router.backends[1].Name != "principal" {
+		t.Errorf("nombres inesperados: %q, %q", router.backends[0].Name, router.backends[1].Name)
+	}
+}
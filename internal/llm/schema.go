@@ -0,0 +1,91 @@
+package llm
+
+import (
+	pb "cloud.google.com/go/ai/generativelanguage/apiv1beta/generativelanguagepb"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// SchemaType es el tipo JSON de un Schema
+type SchemaType string
+
+const (
+	SchemaObject  SchemaType = "object"
+	SchemaArray   SchemaType = "array"
+	SchemaString  SchemaType = "string"
+	SchemaNumber  SchemaType = "number"
+	SchemaInteger SchemaType = "integer"
+	SchemaBoolean SchemaType = "boolean"
+)
+
+// Schema describe un valor JSON mediante el subconjunto de JSON Schema que
+// aceptan todos los proveedores
+type Schema struct {
+	Type        SchemaType         `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+}
+
+// toOpenAI convierte el esquema al formato de go-openai
+func (s *Schema) toOpenAI() jsonschema.Definition {
+	if s == nil {
+		return jsonschema.Definition{Type: jsonschema.Object}
+	}
+
+	def := jsonschema.Definition{
+		Type:        jsonschema.DataType(s.Type),
+		Description: s.Description,
+		Required:    s.Required,
+		Enum:        s.Enum,
+	}
+	if len(s.Properties) > 0 {
+		def.Properties = make(map[string]jsonschema.Definition, len(s.Properties))
+		for name, prop := range s.Properties {
+			def.Properties[name] = prop.toOpenAI()
+		}
+	}
+	if s.Items != nil {
+		items := s.Items.toOpenAI()
+		def.Items = &items
+	}
+	return def
+}
+
+// toGemini convierte el esquema al formato de la API de Gemini
+func (s *Schema) toGemini() *pb.Schema {
+	if s == nil {
+		return nil
+	}
+
+	schema := &pb.Schema{
+		Description: s.Description,
+		Required:    s.Required,
+		Enum:        s.Enum,
+		Items:       s.Items.toGemini(),
+	}
+
+	switch s.Type {
+	case SchemaObject:
+		schema.Type = pb.Type_OBJECT
+	case SchemaArray:
+		schema.Type = pb.Type_ARRAY
+	case SchemaString:
+		schema.Type = pb.Type_STRING
+	case SchemaNumber:
+		schema.Type = pb.Type_NUMBER
+	case SchemaInteger:
+		schema.Type = pb.Type_INTEGER
+	case SchemaBoolean:
+		schema.Type = pb.Type_BOOLEAN
+	}
+
+	if len(s.Properties) > 0 {
+		schema.Properties = make(map[string]*pb.Schema, len(s.Properties))
+		for name, prop := range s.Properties {
+			schema.Properties[name] = prop.toGemini()
+		}
+	}
+	return schema
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseEvent representa un evento de un flujo Server-Sent Events
+type sseEvent struct {
+	Name string
+	Data string
+}
+
+// sseReader lee eventos de un flujo Server-Sent Events
+type sseReader struct {
+	scanner *bufio.Scanner
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &sseReader{scanner: scanner}
+}
+
+// Next devuelve el siguiente evento completo, o io.EOF cuando el flujo termina
+func (r *sseReader) Next() (sseEvent, error) {
+	var event sseEvent
+	var data []string
+
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+
+		if line == "" {
+			if event.Name == "" && len(data) == 0 {
+				continue
+			}
+			event.Data = strings.Join(data, "\n")
+			return event, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Name = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return sseEvent{}, err
+	}
+
+	if event.Name != "" || len(data) > 0 {
+		event.Data = strings.Join(data, "\n")
+		return event, nil
+	}
+
+	return sseEvent{}, io.EOF
+}
@@ -0,0 +1,402 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const defaultStructuredRetries = 2
+
+// structuredValueField es la propiedad en la que se envuelven los esquemas
+// cuya raíz no es un objeto, porque los modos nativos solo admiten objetos
+const structuredValueField = "value"
+
+// jsonChatter lo implementan los proveedores con un modo nativo de salida JSON
+// restringida por esquema. nativeJSON indica si el proveedor admite el esquema.
+type jsonChatter interface {
+	nativeJSON(schema *Schema) bool
+	chatJSON(ctx context.Context, messages []Message, schema *Schema) (string, error)
+}
+
+// StructuredOption modifica el comportamiento de GenerateStructured
+type StructuredOption func(*structuredConfig)
+
+type structuredConfig struct {
+	retries int
+}
+
+// WithValidationRetries cambia cuántas veces se vuelve a preguntar al modelo
+// cuando su respuesta no cumple el esquema (2 por defecto)
+func WithValidationRetries(n int) StructuredOption {
+	return func(cfg *structuredConfig) { cfg.retries = n }
+}
+
+// GenerateStructured pide al modelo una respuesta JSON que cumpla el esquema
+// derivado de out, que debe ser un puntero al valor de destino. Si la
+// respuesta no es válida se vuelve a preguntar indicando el error, hasta
+// WithValidationRetries veces. Si out no es una estructura, el modelo
+// responde con un objeto que lo contiene en la propiedad "value".
+func GenerateStructured(ctx context.Context, model LLM, prompt string, out interface{}, opts ...StructuredOption) error {
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("el destino debe ser un puntero no nulo, se recibió %T", out)
+	}
+
+	cfg := structuredConfig{retries: defaultStructuredRetries}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	schema, err := SchemaFor(out)
+	if err != nil {
+		return err
+	}
+	wrapped := schema.Type != SchemaObject
+	if wrapped {
+		schema = &Schema{
+			Type:       SchemaObject,
+			Properties: map[string]*Schema{structuredValueField: schema},
+			Required:   []string{structuredValueField},
+		}
+	}
+
+	native, hasNative := model.(jsonChatter)
+	hasNative = hasNative && native.nativeJSON(schema)
+
+	var messages []Message
+	if hasNative {
+		messages = []Message{UserMessage(prompt)}
+	} else {
+		schemaJSON, err := json.Marshal(schema)
+		if err != nil {
+			return fmt.Errorf("error al codificar el esquema: %w", err)
+		}
+		messages = []Message{
+			SystemMessage("Responde únicamente con un objeto JSON válido, sin texto adicional, que cumpla este JSON Schema:\n" + string(schemaJSON)),
+			UserMessage(prompt),
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= cfg.retries; attempt++ {
+		var reply string
+		if hasNative {
+			reply, err = native.chatJSON(ctx, messages, schema)
+		} else {
+			reply, err = model.Chat(ctx, messages)
+		}
+		if err != nil {
+			return err
+		}
+
+		lastErr = decodeStructured(reply, schema, wrapped, out)
+		if lastErr == nil {
+			return nil
+		}
+
+		messages = append(messages,
+			AssistantMessage(reply),
+			UserMessage(fmt.Sprintf("La respuesta anterior no es válida: %v. Responde de nuevo solo con el JSON corregido.", lastErr)),
+		)
+	}
+
+	return fmt.Errorf("no se obtuvo una respuesta estructurada válida tras %d intentos: %w", cfg.retries+1, lastErr)
+}
+
+// decodeStructured valida la respuesta contra el esquema y la decodifica en
+// out. Con wrapped se decodifica solo la propiedad "value".
+func decodeStructured(reply string, schema *Schema, wrapped bool, out interface{}) error {
+	data := []byte(stripCodeFence(reply))
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("JSON mal formado: %w", err)
+	}
+
+	if err := schema.Validate(value); err != nil {
+		return err
+	}
+
+	if wrapped {
+		var envelope map[string]json.RawMessage
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return fmt.Errorf("JSON mal formado: %w", err)
+		}
+		data = envelope[structuredValueField]
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("el JSON no encaja en %T: %w", out, err)
+	}
+
+	return nil
+}
+
+// stripCodeFence elimina el bloque ```json con el que algunos modelos envuelven la respuesta
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+		text = text[newline+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
+
+// SchemaFor deriva un esquema JSON a partir del tipo de v mediante reflexión.
+// Se respetan las etiquetas json (los campos con omitempty no son obligatorios)
+// y las etiquetas description y enum (valores separados por comas, solo en campos
+// de texto).
+func SchemaFor(v interface{}) (*Schema, error) {
+	if v == nil {
+		return nil, fmt.Errorf("no se puede derivar un esquema de un valor nulo")
+	}
+	return schemaForType(reflect.TypeOf(v), map[reflect.Type]bool{})
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func schemaForType(t reflect.Type, visiting map[reflect.Type]bool) (*Schema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: SchemaString, Description: "fecha en formato RFC 3339"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: SchemaString}, nil
+	case reflect.Bool:
+		return &Schema{Type: SchemaBoolean}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: SchemaInteger}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: SchemaNumber}, nil
+	case reflect.Slice, reflect.Array:
+		// encoding/json codifica []byte como un string en base64
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: SchemaString, Description: "datos codificados en base64"}, nil
+		}
+		items, err := schemaForType(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: SchemaArray, Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("solo se admiten mapas con claves string, se recibió %s", t)
+		}
+		return &Schema{Type: SchemaObject}, nil
+	case reflect.Struct:
+		return schemaForStruct(t, visiting)
+	default:
+		return nil, fmt.Errorf("tipo no soportado en el esquema: %s", t)
+	}
+}
+
+func schemaForStruct(t reflect.Type, visiting map[reflect.Type]bool) (*Schema, error) {
+	if visiting[t] {
+		return nil, fmt.Errorf("los tipos recursivos no están soportados: %s", t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	schema := &Schema{Type: SchemaObject, Properties: map[string]*Schema{}}
+	depths := map[string]int{}
+	if err := addStructFields(schema, depths, t, 0, visiting); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// addStructFields añade al esquema los campos de t. Como en encoding/json, los
+// campos de las estructuras embebidas sin nombre en la etiqueta json se
+// promocionan al objeto que las contiene, y ante nombres repetidos gana el
+// campo menos anidado.
+func addStructFields(schema *Schema, depths map[string]int, t reflect.Type, depth int, visiting map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := ""
+		required := true
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" && len(parts) == 1 {
+				continue
+			}
+			name = parts[0]
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					required = false
+				}
+			}
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				// encoding/json no puede rellenar un puntero a una estructura no exportada
+				if !field.IsExported() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if visiting[embedded] {
+					return fmt.Errorf("los tipos recursivos no están soportados: %s", embedded)
+				}
+				visiting[embedded] = true
+				err := addStructFields(schema, depths, embedded, depth+1, visiting)
+				delete(visiting, embedded)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if d, ok := depths[name]; ok && d <= depth {
+			continue
+		}
+
+		prop, err := schemaForType(field.Type, visiting)
+		if err != nil {
+			return fmt.Errorf("campo %s: %w", field.Name, err)
+		}
+		// Los tipos como time.Time ya traen su propia descripción
+		if description := field.Tag.Get("description"); description != "" {
+			prop.Description = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			if prop.Type != SchemaString {
+				return fmt.Errorf("campo %s: la etiqueta enum solo se admite en campos de texto", field.Name)
+			}
+			prop.Enum = strings.Split(enum, ",")
+		}
+
+		if _, replaced := depths[name]; replaced {
+			schema.Required = removeString(schema.Required, name)
+		}
+		depths[name] = depth
+		schema.Properties[name] = prop
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+// closed indica si todos los objetos del esquema declaran sus propiedades.
+// OpenAI y Gemini rechazan en sus modos nativos los objetos sin propiedades,
+// que es como se representan los mapas.
+func (s *Schema) closed() bool {
+	if s == nil {
+		return true
+	}
+	if s.Type == SchemaObject && len(s.Properties) == 0 {
+		return false
+	}
+	for _, prop := range s.Properties {
+		if !prop.closed() {
+			return false
+		}
+	}
+	return s.Items.closed()
+}
+
+// Validate comprueba que un valor decodificado de JSON cumple el esquema
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate(value, "$")
+}
+
+func (s *Schema) validate(value interface{}, path string) error {
+	if s == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case SchemaObject:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: se esperaba un objeto", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: falta el campo obligatorio %q", path, name)
+			}
+		}
+		for name, prop := range s.Properties {
+			if v, ok := obj[name]; ok && v != nil {
+				if err := prop.validate(v, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case SchemaArray:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: se esperaba un array", path)
+		}
+		for i, item := range arr {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case SchemaString:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: se esperaba un string", path)
+		}
+		if len(s.Enum) > 0 && !containsString(s.Enum, str) {
+			return fmt.Errorf("%s: el valor %q no está entre %v", path, str, s.Enum)
+		}
+	case SchemaNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: se esperaba un número", path)
+		}
+	case SchemaInteger:
+		num, ok := value.(float64)
+		if !ok || num != float64(int64(num)) {
+			return fmt.Errorf("%s: se esperaba un entero", path)
+		}
+	case SchemaBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: se esperaba un booleano", path)
+		}
+	}
+
+	return nil
+}
+
+func removeString(values []string, value string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type structuredBase struct {
+	ID     string `json:"id"`
+	Nombre string `json:"nombre"`
+}
+
+type StructuredAudit struct {
+	Autor string `json:"autor,omitempty"`
+}
+
+type structuredDoc struct {
+	structuredBase
+	*StructuredAudit
+	Nombre  string            `json:"titulo_nombre"`
+	ID      int               `json:"id"`
+	Datos   []byte            `json:"datos"`
+	Extra   map[string]string `json:"extra,omitempty"`
+	Anidado StructuredAudit   `json:"anidado"`
+}
+
+func TestSchemaForFlattensEmbeddedStructs(t *testing.T) {
+	schema, err := SchemaFor(&structuredDoc{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"anidado", "autor", "datos", "extra", "id", "nombre", "titulo_nombre"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("propiedades %v, se esperaba %v", names, want)
+	}
+	if schema.Properties["id"].Type != SchemaInteger {
+		t.Errorf("el campo id del nivel superior debe ganar al embebido: %+v", schema.Properties["id"])
+	}
+	if schema.Properties["datos"].Type != SchemaString {
+		t.Errorf("[]byte debe ser un string en base64: %+v", schema.Properties["datos"])
+	}
+
+	required := append([]string(nil), schema.Required...)
+	sort.Strings(required)
+	if !reflect.DeepEqual(required, []string{"anidado", "datos", "id", "nombre", "titulo_nombre"}) {
+		t.Errorf("obligatorios inesperados: %v", required)
+	}
+	if schema.closed() {
+		t.Error("un mapa no declara propiedades, así que el esquema no es cerrado")
+	}
+}
+
+func TestSchemaForFieldTags(t *testing.T) {
+	schema, err := SchemaFor(&struct {
+		Fecha  time.Time `json:"fecha"`
+		Firma  []byte    `json:"firma" description:"firma del documento"`
+		Estado string    `json:"estado" enum:"abierto,cerrado"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if schema.Properties["fecha"].Description != "fecha en formato RFC 3339" {
+		t.Errorf("se perdió la descripción de time.Time: %+v", schema.Properties["fecha"])
+	}
+	if schema.Properties["firma"].Description != "firma del documento" {
+		t.Errorf("la etiqueta description debe sustituir a la del tipo: %+v", schema.Properties["firma"])
+	}
+	if !reflect.DeepEqual(schema.Properties["estado"].Enum, []string{"abierto", "cerrado"}) {
+		t.Errorf("enum inesperado: %+v", schema.Properties["estado"])
+	}
+
+	if _, err := SchemaFor(&struct {
+		Prioridad int `json:"prioridad" enum:"1,2,3"`
+	}{}); err == nil {
+		t.Error("enum en un campo que no es de texto debe dar error")
+	}
+}
+
+func TestGenerateStructuredEmbeddedRoundTrip(t *testing.T) {
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{{
+		Content: `{"id": 7, "nombre": "base", "titulo_nombre": "doc", "datos": "aG9sYQ==", "anidado": {}, "autor": "ana"}`,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc structuredDoc
+	if err := GenerateStructured(context.Background(), mock, "Dame un documento", &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.structuredBase.Nombre != "base" || string(doc.Datos) != "hola" || doc.StructuredAudit == nil || doc.Autor != "ana" {
+		t.Errorf("documento inesperado: %+v", doc)
+	}
+}
+
+func TestGenerateStructuredWrapsNonObjectRoot(t *testing.T) {
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{
+		{Content: `[{"id": "1", "nombre": "a"}]`},
+		{Content: "```json\n{\"value\": [{\"id\": \"1\", \"nombre\": \"a\"}, {\"id\": \"2\", \"nombre\": \"b\"}]}\n```"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []structuredBase
+	if err := GenerateStructured(context.Background(), mock, "Dame dos elementos", &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[1].Nombre != "b" {
+		t.Errorf("elementos inesperados: %+v", items)
+	}
+	if calls := mock.Calls(); len(calls) != 2 {
+		t.Errorf("se esperaban 2 llamadas, hubo %d", len(calls))
+	}
+}
+
+func TestGenerateStructuredValidationRetries(t *testing.T) {
+	mock, err := NewMock(MockConfig{Responses: []MockResponse{{Content: `{"id": 1}`, Repeat: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var base structuredBase
+	if err := GenerateStructured(context.Background(), mock, "Dame un elemento", &base, WithValidationRetries(0)); err == nil {
+		t.Fatal("se esperaba un error de validación")
+	}
+	if calls := mock.Calls(); len(calls) != 1 {
+		t.Errorf("sin reintentos se esperaba 1 llamada, hubo %d", len(calls))
+	}
+}
+
+func TestGenerateStructuredOpenAICompatibleUsesPrompt(t *testing.T) {
+	var body map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		json.Unmarshal(raw, &body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices": [{"message": {"role": "assistant", "content": "{\"id\": \"1\", \"nombre\": \"a\"}"}, "finish_reason": "stop"}]}`)
+	}))
+	defer server.Close()
+
+	model, err := New(Config{Provider: OpenAICompatible, ModelName: "llama3", BaseURL: server.URL, MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var base structuredBase
+	if err := GenerateStructured(context.Background(), model, "Dame un elemento", &base); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["response_format"]; ok {
+		t.Errorf("no se debe forzar response_format en un servidor compatible: %s", body["response_format"])
+	}
+	if base.Nombre != "a" {
+		t.Errorf("respuesta inesperada: %+v", base)
+	}
+}
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+const defaultMaxToolIterations = 10
+
+// Tool describe una función que el modelo puede solicitar ejecutar
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  *Schema
+}
+
+// ToolCall representa una llamada a herramienta solicitada por el modelo.
+// Arguments contiene los argumentos codificados en JSON.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// ToolFunc ejecuta una herramienta con los argumentos JSON generados por el modelo
+type ToolFunc func(ctx context.Context, arguments string) (string, error)
+
+// ToolMessage crea el mensaje con el resultado de una llamada a herramienta
+func ToolMessage(call ToolCall, content string) Message {
+	return Message{
+		Role:       RoleTool,
+		Content:    content,
+		ToolCallID: call.ID,
+		Name:       call.Name,
+	}
+}
+
+// ToolRunner ejecuta las herramientas registradas y devuelve sus resultados al
+// modelo hasta que este produce una respuesta final
+type ToolRunner struct {
+	LLM           LLM
+	MaxIterations int
+
+	tools    []Tool
+	handlers map[string]ToolFunc
+}
+
+// NewToolRunner crea un ToolRunner sin herramientas registradas
+func NewToolRunner(model LLM) *ToolRunner {
+	return &ToolRunner{
+		LLM:           model,
+		MaxIterations: defaultMaxToolIterations,
+		handlers:      make(map[string]ToolFunc),
+	}
+}
+
+// Register añade una herramienta y la función que la implementa
+func (r *ToolRunner) Register(tool Tool, fn ToolFunc) {
+	if _, exists := r.handlers[tool.Name]; !exists {
+		r.tools = append(r.tools, tool)
+	} else {
+		for i := range r.tools {
+			if r.tools[i].Name == tool.Name {
+				r.tools[i] = tool
+			}
+		}
+	}
+	r.handlers[tool.Name] = fn
+}
+
+// Run envía la conversación al modelo y resuelve las llamadas a herramientas
+// que solicite. Devuelve la respuesta final junto con la conversación completa,
+// incluidos los mensajes de herramientas intermedios.
+func (r *ToolRunner) Run(ctx context.Context, messages []Message) (*Response, []Message, error) {
+	conversation := append([]Message(nil), messages...)
+
+	maxIterations := r.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultMaxToolIterations
+	}
+
+	for i := 0; i < maxIterations; i++ {
+		resp, err := r.LLM.ChatWithTools(ctx, conversation, r.tools)
+		if err != nil {
+			return nil, conversation, err
+		}
+
+		conversation = append(conversation, Message{
+			Role:      RoleAssistant,
+			Content:   resp.Content,
+			ToolCalls: resp.ToolCalls,
+		})
+
+		if len(resp.ToolCalls) == 0 {
+			return resp, conversation, nil
+		}
+
+		for _, call := range resp.ToolCalls {
+			conversation = append(conversation, ToolMessage(call, r.execute(ctx, call)))
+		}
+	}
+
+	return nil, conversation, fmt.Errorf("se alcanzó el máximo de %d iteraciones sin una respuesta final", maxIterations)
+}
+
+// execute invoca la herramienta solicitada. Los errores se devuelven como texto
+// para que el modelo pueda corregir la llamada.
+func (r *ToolRunner) execute(ctx context.Context, call ToolCall) string {
+	fn, ok := r.handlers[call.Name]
+	if !ok {
+		return fmt.Sprintf("error: herramienta desconocida %q", call.Name)
+	}
+
+	result, err := fn(ctx, call.Arguments)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return result
+}
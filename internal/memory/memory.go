@@ -0,0 +1,290 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/codigogp/letsgollm/internal/llm"
+)
+
+// defaultContextWindow se usa cuando el modelo no está en la tabla de ventanas
+const defaultContextWindow = 4096
+
+// ErrContextWindowExceeded indica que los mensajes fijados y el último turno
+// no caben por sí solos en la ventana de contexto
+var ErrContextWindowExceeded = errors.New("los mensajes no caben en la ventana de contexto")
+
+// Strategy indica cómo se recorta el historial cuando no cabe en la ventana de contexto
+type Strategy int
+
+const (
+	// SlidingWindow descarta los turnos más antiguos
+	SlidingWindow Strategy = iota
+	// Summarize sustituye los turnos más antiguos por un resumen generado con Summarizer
+	Summarize
+)
+
+// summaryPrompt es la instrucción con la que se pide el resumen de los turnos antiguos
+const summaryPrompt = "Resume de forma concisa la siguiente conversación. Conserva los datos, " +
+	"decisiones y preferencias del usuario que sean necesarios para continuarla. " +
+	"Responde solo con el resumen."
+
+// Memory guarda los turnos de una conversación y, antes de cada llamada,
+// construye una lista de mensajes que cabe en la ventana de contexto del
+// modelo. Los mensajes fijados (los de sistema, por defecto) se envían siempre.
+// MaxTokens es el tamaño de la ventana (si es cero se busca Model en Windows o
+// DefaultContextWindows) y ReserveTokens los tokens que se dejan libres para la
+// respuesta. CountTokens sustituye a EstimateTokens para contar tokens con
+// precisión. Es seguro usar una Memory desde varias goroutines.
+type Memory struct {
+	Model         string
+	Strategy      Strategy
+	MaxTokens     int
+	ReserveTokens int
+	Summarizer    llm.LLM
+	CountTokens   TokenCounter
+	Windows       ContextWindows
+
+	mu      sync.Mutex
+	pinned  []llm.Message
+	turns   []llm.Message
+	summary string
+	// generation cambia cada vez que se quitan turnos del principio
+	generation int
+}
+
+// New crea una memoria para el modelo indicado con la estrategia de recorte dada
+func New(model string, strategy Strategy) *Memory {
+	return &Memory{Model: model, Strategy: strategy}
+}
+
+// Pin añade mensajes que se envían siempre al principio, sin recortarlos nunca
+func (m *Memory) Pin(messages ...llm.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pinned = append(m.pinned, messages...)
+}
+
+// Add añade turnos a la conversación. Los mensajes de sistema se fijan como con Pin.
+func (m *Memory) Add(messages ...llm.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range messages {
+		if msg.Role == llm.RoleSystem {
+			m.pinned = append(m.pinned, msg)
+			continue
+		}
+		m.turns = append(m.turns, msg)
+	}
+}
+
+// Turns devuelve una copia de los turnos guardados que no se han resumido ni descartado
+func (m *Memory) Turns() []llm.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]llm.Message(nil), m.turns...)
+}
+
+// Summary devuelve el resumen de los turnos antiguos, vacío si no se ha generado ninguno
+func (m *Memory) Summary() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.summary
+}
+
+// Clear borra los turnos y el resumen, conservando los mensajes fijados
+func (m *Memory) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.turns = nil
+	m.summary = ""
+	m.generation++
+}
+
+// Budget devuelve los tokens disponibles para los mensajes: la ventana de
+// contexto menos los reservados para la respuesta
+func (m *Memory) Budget() int {
+	window := m.MaxTokens
+	if window <= 0 {
+		windows := m.Windows
+		if windows == nil {
+			windows = DefaultContextWindows
+		}
+		var ok bool
+		if window, ok = windows.Lookup(m.Model); !ok {
+			window = defaultContextWindow
+		}
+	}
+	return window - m.ReserveTokens
+}
+
+// Tokens cuenta los tokens de una lista de mensajes con el contador configurado
+func (m *Memory) Tokens(messages []llm.Message) int {
+	count := m.CountTokens
+	if count == nil {
+		count = EstimateTokens
+	}
+
+	tokens := 0
+	for _, msg := range messages {
+		tokens += count(m.Model, msg)
+	}
+	return tokens
+}
+
+// Messages devuelve los mensajes que se deben enviar al modelo: los fijados,
+// el resumen si lo hay y los turnos más recientes que caben en el presupuesto.
+// Los turnos que no caben dejan de guardarse: con SlidingWindow se descartan y
+// con Summarize se resumen. La llamada al Summarizer se hace sin bloquear la
+// memoria. Devuelve ErrContextWindowExceeded si ni siquiera cabe el último turno.
+func (m *Memory) Messages(ctx context.Context) ([]llm.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups := groupTurns(m.turns)
+	keep := m.fit(groups)
+
+	// El último turno no se resume nunca: si no cabe se devuelve el error
+	if m.Strategy == Summarize && keep > 0 && keep < len(groups) {
+		if m.Summarizer == nil {
+			return nil, fmt.Errorf("la estrategia Summarize necesita un Summarizer")
+		}
+
+		var err error
+		if groups, err = m.summarizeOldest(ctx, groups, keep); err != nil {
+			return nil, err
+		}
+		// El resumen nuevo puede ocupar más que el anterior; los turnos que
+		// queden fuera se resumirán en la siguiente llamada
+		keep = m.fit(groups)
+	}
+
+	if keep == 0 && len(groups) > 0 {
+		return nil, fmt.Errorf("%w: el último turno necesita %d tokens y el presupuesto es de %d",
+			ErrContextWindowExceeded, m.Tokens(m.head())+m.Tokens(groups[len(groups)-1]), m.Budget())
+	}
+
+	if m.Strategy == SlidingWindow && keep < len(groups) {
+		m.dropOldest(countMessages(groups[:len(groups)-keep]))
+		groups = groups[len(groups)-keep:]
+	}
+
+	messages := m.head()
+	for _, group := range groups[len(groups)-keep:] {
+		messages = append(messages, group...)
+	}
+	return messages, nil
+}
+
+// summarizeOldest resume los grupos más antiguos, dejando los keep más
+// recientes, y devuelve los grupos que quedan guardados. Se llama con m.mu
+// bloqueado, pero lo libera mientras responde el Summarizer; si entretanto
+// cambian los turnos antiguos (por Clear u otro resumen) el resumen se descarta.
+func (m *Memory) summarizeOldest(ctx context.Context, groups [][]llm.Message, keep int) ([][]llm.Message, error) {
+	dropped := countMessages(groups[:len(groups)-keep])
+	turns := append([]llm.Message(nil), m.turns[:dropped]...)
+	previous := m.summary
+	generation := m.generation
+
+	m.mu.Unlock()
+	summary, err := m.summarize(ctx, previous, turns)
+	m.mu.Lock()
+	if err != nil {
+		return nil, err
+	}
+
+	if m.generation == generation {
+		m.summary = summary
+		m.dropOldest(dropped)
+	}
+	return groupTurns(m.turns), nil
+}
+
+// dropOldest deja de guardar los n turnos más antiguos
+func (m *Memory) dropOldest(n int) {
+	m.turns = append([]llm.Message(nil), m.turns[n:]...)
+	m.generation++
+}
+
+// head devuelve los mensajes que preceden siempre a los turnos: los fijados y el resumen
+func (m *Memory) head() []llm.Message {
+	head := append([]llm.Message(nil), m.pinned...)
+	if m.summary != "" {
+		head = append(head, llm.SystemMessage("Resumen de la conversación anterior:\n"+m.summary))
+	}
+	return head
+}
+
+// fit devuelve cuántos de los grupos más recientes caben en el presupuesto junto a head
+func (m *Memory) fit(groups [][]llm.Message) int {
+	remaining := m.Budget() - m.Tokens(m.head())
+	keep := 0
+	for i := len(groups) - 1; i >= 0; i-- {
+		remaining -= m.Tokens(groups[i])
+		if remaining < 0 {
+			break
+		}
+		keep++
+	}
+
+	// Si se recorta, la conversación debe seguir empezando por un mensaje del
+	// usuario, porque algunos proveedores (Anthropic, Gemini) lo exigen
+	if keep < len(groups) {
+		for keep > 1 && groups[len(groups)-keep][0].Role != llm.RoleUser {
+			keep--
+		}
+	}
+	return keep
+}
+
+// summarize pide al Summarizer un resumen del resumen anterior y los turnos indicados
+func (m *Memory) summarize(ctx context.Context, previous string, turns []llm.Message) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("Resumen previo:\n")
+		transcript.WriteString(previous)
+		transcript.WriteString("\n\n")
+	}
+	for _, msg := range turns {
+		content := msg.Content
+		for _, call := range msg.ToolCalls {
+			content += fmt.Sprintf("\n[llamada a %s(%s)]", call.Name, call.Arguments)
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, content)
+	}
+
+	summary, err := m.Summarizer.Chat(ctx, []llm.Message{
+		llm.SystemMessage(summaryPrompt),
+		llm.UserMessage(transcript.String()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error al resumir la conversación: %w", err)
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+// countMessages cuenta los mensajes de una lista de grupos
+func countMessages(groups [][]llm.Message) int {
+	n := 0
+	for _, group := range groups {
+		n += len(group)
+	}
+	return n
+}
+
+// groupTurns agrupa cada mensaje del asistente con los resultados de sus
+// llamadas a herramientas, para que el recorte nunca los separe
+func groupTurns(turns []llm.Message) [][]llm.Message {
+	var groups [][]llm.Message
+	for _, msg := range turns {
+		if msg.Role == llm.RoleTool && len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], msg)
+			continue
+		}
+		groups = append(groups, []llm.Message{msg})
+	}
+	return groups
+}
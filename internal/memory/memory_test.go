@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/codigogp/letsgollm/internal/llm"
+)
+
+// tenTokens cuenta diez tokens por mensaje para que los presupuestos sean exactos
+func tenTokens(model string, msg llm.Message) int {
+	return 10
+}
+
+// conversation devuelve n turnos alternos del usuario y del asistente
+func conversation(n int) []llm.Message {
+	var turns []llm.Message
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			turns = append(turns, llm.UserMessage(fmt.Sprintf("pregunta %d", i)))
+		} else {
+			turns = append(turns, llm.AssistantMessage(fmt.Sprintf("respuesta %d", i)))
+		}
+	}
+	return turns
+}
+
+// blockingSummarizer es un LLM cuyo Chat espera a release antes de responder
+type blockingSummarizer struct {
+	llm.LLM
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingSummarizer() *blockingSummarizer {
+	return &blockingSummarizer{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (b *blockingSummarizer) Chat(ctx context.Context, messages []llm.Message) (string, error) {
+	close(b.started)
+	<-b.release
+	return "resumen", nil
+}
+
+// within falla el test si f no termina a tiempo
+func within(t *testing.T, what string, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("%s se bloqueó mientras se resumía", what)
+	}
+}
+
+func TestSlidingWindowDropsOldTurns(t *testing.T) {
+	m := &Memory{Model: "test", Strategy: SlidingWindow, MaxTokens: 50, CountTokens: tenTokens}
+	m.Pin(llm.SystemMessage("Eres útil."))
+	m.Add(conversation(7)...)
+
+	messages, err := m.Messages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Caben cuatro turnos tras el mensaje fijado, pero deben empezar por el usuario
+	if len(messages) != 4 || messages[1].Content != "pregunta 4" || messages[3].Content != "pregunta 6" {
+		t.Errorf("mensajes inesperados: %+v", messages)
+	}
+	turns := m.Turns()
+	if len(turns) != 3 || turns[0].Content != "pregunta 4" {
+		t.Errorf("los turnos descartados deben dejar de guardarse: %+v", turns)
+	}
+}
+
+func TestSummarizeReleasesLock(t *testing.T) {
+	summarizer := newBlockingSummarizer()
+	m := &Memory{Model: "test", Strategy: Summarize, MaxTokens: 40, CountTokens: tenTokens, Summarizer: summarizer}
+	m.Add(conversation(5)...)
+
+	result := make(chan []llm.Message, 1)
+	go func() {
+		messages, err := m.Messages(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		result <- messages
+	}()
+
+	<-summarizer.started
+	within(t, "Add", func() { m.Add(llm.AssistantMessage("respuesta 5")) })
+	within(t, "Turns", func() { m.Turns() })
+	close(summarizer.release)
+
+	messages := <-result
+	if m.Summary() != "resumen" {
+		t.Errorf("resumen inesperado: %q", m.Summary())
+	}
+	if len(messages) == 0 || messages[0].Role != llm.RoleSystem {
+		t.Errorf("el resumen debe ir al principio: %+v", messages)
+	}
+	turns := m.Turns()
+	if len(turns) == 0 || turns[len(turns)-1].Content != "respuesta 5" {
+		t.Errorf("se perdió el turno añadido durante el resumen: %+v", turns)
+	}
+}
+
+func TestSummarizeDiscardedAfterClear(t *testing.T) {
+	summarizer := newBlockingSummarizer()
+	m := &Memory{Model: "test", Strategy: Summarize, MaxTokens: 40, CountTokens: tenTokens, Summarizer: summarizer}
+	m.Add(conversation(5)...)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := m.Messages(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	<-summarizer.started
+	within(t, "Clear", m.Clear)
+	close(summarizer.release)
+	<-done
+
+	if m.Summary() != "" || len(m.Turns()) != 0 {
+		t.Errorf("el resumen de turnos borrados no debe guardarse: %q %+v", m.Summary(), m.Turns())
+	}
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codigogp/letsgollm/internal/llm"
+	"github.com/codigogp/letsgollm/internal/tools/tokenizer"
+)
+
+// messageOverhead son los tokens que añade cada mensaje por el rol y los
+// separadores del formato de chat
+const messageOverhead = 4
+
+// imageTokens es la estimación de tokens de cada imagen adjunta
+const imageTokens = 765
+
+// TokenCounter cuenta los tokens que ocupa un mensaje en el modelo
+type TokenCounter func(model string, msg llm.Message) int
+
+// EstimateTokens es el TokenCounter por defecto: aproxima un token por cada
+// cuatro caracteres, más el coste fijo de cada mensaje, imagen y llamada a
+// herramienta
+func EstimateTokens(model string, msg llm.Message) int {
+	tokens := messageOverhead + estimateText(msg.Content) + estimateText(msg.Name)
+	tokens += len(msg.Images) * imageTokens
+	for _, call := range msg.ToolCalls {
+		tokens += messageOverhead + estimateText(call.Name) + estimateText(call.Arguments)
+	}
+	return tokens
+}
+
+// CountWith devuelve un TokenCounter que cuenta el texto de los mensajes con
+// un tokenizador BPE en lugar de estimarlo
+func CountWith(enc *tokenizer.Encoding) TokenCounter {
+	return func(model string, msg llm.Message) int {
+		tokens := messageOverhead + enc.Count(msg.Content) + enc.Count(msg.Name)
+		tokens += len(msg.Images) * imageTokens
+		for _, call := range msg.ToolCalls {
+			tokens += messageOverhead + enc.Count(call.Name) + enc.Count(call.Arguments)
+		}
+		return tokens
+	}
+}
+
+func estimateText(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// ContextWindows asocia nombres de modelo con el tamaño de su ventana de
+// contexto en tokens. Igual que llm.PriceTable, un nombre también sirve como
+// prefijo de las versiones fechadas del modelo.
+type ContextWindows map[string]int
+
+// DefaultContextWindows contiene la ventana de contexto de los modelos más habituales
+var DefaultContextWindows = ContextWindows{
+	"gpt-4o":            128000,
+	"gpt-4-turbo":       128000,
+	"gpt-4":             8192,
+	"gpt-3.5-turbo":     16385,
+	"claude-3":          200000,
+	"gemini-1.5-pro":    2097152,
+	"gemini-1.5-flash":  1048576,
+	"gemini-1.0-pro":    32760,
+	"llama3.1":          131072,
+	"llama3":            8192,
+	"mistral":           32768,
+	"mixtral":           32768,
+	"qwen2":             32768,
+	"phi3":              4096,
+	"gemma2":            8192,
+	"command-r":         128000,
+	"deepseek-coder-v2": 163840,
+}
+
+// Lookup devuelve la ventana de contexto de un modelo, buscando primero el
+// nombre exacto y después el prefijo más largo que coincida
+func (w ContextWindows) Lookup(model string) (int, bool) {
+	if size, ok := w[model]; ok {
+		return size, true
+	}
+
+	best := ""
+	for name := range w {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return 0, false
+	}
+	return w[best], true
+}
@@ -1,19 +1,35 @@
 package chunker
 
 import (
+	"context"
 	"math"
 	"regexp"
-	"sort"
 	"strings"
 
+	"github.com/codigogp/letsgollm/internal/llm"
 	"github.com/jdkato/prose/v2"
 )
 
-// ChunkInfo representa la información de un chunk de texto
+// ChunkInfo representa la información de un chunk de texto. Start y End son
+// las posiciones en bytes del chunk dentro del texto original, de modo que
+// Text == texto[Start:End]; solo las rellenan los chunkers que las conocen.
+// Metadata contiene datos adicionales que dependen del chunker, como la ruta
+// de encabezados en Markdown. Los campos de procedencia (ID, Source, Index,
+// RuneStart, RuneEnd, Page y Hash) los completa WithProvenance.
 type ChunkInfo struct {
 	Text          string
 	NumCharacters int
 	NumWords      int
+	Start         int
+	End           int
+	Metadata      map[string]interface{}
+	ID            string
+	Source        string
+	Index         int
+	RuneStart     int
+	RuneEnd       int
+	Page          int
+	Hash          string
 }
 
 // TextChunks representa una colección de chunks de texto
@@ -99,42 +115,32 @@ func ChunkByParagraphs(text string) TextChunks {
 	}
 }
 
-// ChunkBySemantics divide el texto en chunks basados en semántica
+// ChunkBySemantics divide el texto en chunks basados en semántica. Usa una
+// representación léxica de las oraciones; ChunkSemantically permite usar
+// embeddings reales y ajustar el umbral. thresholdPercentage es el percentil
+// de las distancias a partir del cual se corta; 0 corta tras cada oración
+// salvo donde la distancia es la mínima.
 func ChunkBySemantics(text string, thresholdPercentage float64) TextChunks {
-	sentences := splitSentences(text)
-	combinedSentences := combineSentences(sentences)
-	embeddings := convertToVector(combinedSentences)
-	distances := calculateCosineSimilarities(embeddings)
-
-	// Ordenar las distancias para el cálculo del umbral
-	sortedDistances := make([]float64, len(distances))
-	copy(sortedDistances, distances)
-	sort.Float64s(sortedDistances)
-
-	// Calcular el umbral usando el percentil
-	thresholdIndex := int(float64(len(sortedDistances)-1) * thresholdPercentage / 100)
-	breakpointDistanceThreshold := sortedDistances[thresholdIndex]
-
-	var chunks []ChunkInfo
-	startIndex := 0
-
-	for i, distance := range distances {
-		if distance > breakpointDistanceThreshold {
-			chunk := strings.Join(sentences[startIndex:i+1], " ")
-			chunks = append(chunks, createChunkInfo(chunk))
-			startIndex = i + 1
-		}
-	}
+	// La representación léxica no puede fallar
+	chunks, _ := ChunkSemantically(context.Background(), text, SemanticChunkConfig{Threshold: percentileThreshold(thresholdPercentage)})
+	return chunks
+}
 
-	if startIndex < len(sentences) {
-		chunk := strings.Join(sentences[startIndex:], " ")
-		chunks = append(chunks, createChunkInfo(chunk))
-	}
+// ChunkBySemanticsWithEmbedder divide el texto en chunks basados en semántica usando
+// los embeddings reales generados por el Embedder. thresholdPercentage tiene el
+// mismo significado que en ChunkBySemantics.
+func ChunkBySemanticsWithEmbedder(ctx context.Context, text string, embedder llm.Embedder, thresholdPercentage float64) (TextChunks, error) {
+	return ChunkSemantically(ctx, text, SemanticChunkConfig{Embed: embedder.Embed, Threshold: percentileThreshold(thresholdPercentage)})
+}
 
-	return TextChunks{
-		NumChunks: len(chunks),
-		ChunkList: chunks,
+// percentileThreshold conserva el significado de un percentil 0, que en
+// SemanticChunkConfig elegiría el percentil por defecto: el menor valor
+// positivo da el mismo umbral que el percentil 0
+func percentileThreshold(thresholdPercentage float64) float64 {
+	if thresholdPercentage <= 0 {
+		return math.SmallestNonzeroFloat64
 	}
+	return thresholdPercentage
 }
 
 func createChunkInfo(text string) ChunkInfo {
@@ -145,53 +151,10 @@ func createChunkInfo(text string) ChunkInfo {
 	}
 }
 
-func splitSentences(text string) []string {
-	return regexp.MustCompile(`[.!?]+\s+`).Split(text, -1)
-}
-
-func combineSentences(sentences []string) []string {
-	combined := make([]string, len(sentences))
-	for i, sentence := range sentences {
-		if i > 0 {
-			combined[i] = sentences[i-1] + " " + sentence
-		}
-		if i < len(sentences)-1 {
-			combined[i] += " " + sentences[i+1]
-		}
-	}
-	return combined
-}
-
-func convertToVector(sentences []string) [][]float64 {
-	// Esta es una implementación simplificada. En la práctica, necesitarías usar
-	// un modelo de embedding real, como Word2Vec o BERT.
-	vectors := make([][]float64, len(sentences))
-	for i, sentence := range sentences {
-		vector := make([]float64, 10) // Usar 10 dimensiones como ejemplo
-		for j, word := range strings.Fields(sentence) {
-			vector[j%10] += float64(len(word))
-		}
-		vectors[i] = vector
-	}
-	return vectors
-}
-
-func calculateCosineSimilarities(vectors [][]float64) []float64 {
-	similarities := make([]float64, len(vectors)-1)
-	for i := 0; i < len(vectors)-1; i++ {
-		similarities[i] = cosineSimilarity(vectors[i], vectors[i+1])
-	}
-	return similarities
-}
-
-func cosineSimilarity(a, b []float64) float64 {
-	dot := 0.0
-	normA := 0.0
-	normB := 0.0
-	for i := range a {
-		dot += a[i] * b[i]
-		normA += a[i] * a[i]
-		normB += b[i] * b[i]
-	}
-	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+// createChunkInfoAt crea el chunk text[start:end] guardando sus posiciones
+func createChunkInfoAt(text string, start, end int) ChunkInfo {
+	chunk := createChunkInfo(text[start:end])
+	chunk.Start = start
+	chunk.End = end
+	return chunk
 }
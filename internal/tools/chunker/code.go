@@ -0,0 +1,354 @@
+package chunker
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// codeStyle indica cómo se delimitan los bloques de un lenguaje sin parser propio
+type codeStyle int
+
+const (
+	styleBraces codeStyle = iota
+	styleIndent
+)
+
+// codeLanguages asocia extensiones de archivo con el lenguaje y su estilo de bloques
+var codeLanguages = map[string]struct {
+	name  string
+	style codeStyle
+}{
+	".go":    {"go", styleBraces},
+	".c":     {"c", styleBraces},
+	".h":     {"c", styleBraces},
+	".cc":    {"cpp", styleBraces},
+	".cpp":   {"cpp", styleBraces},
+	".hpp":   {"cpp", styleBraces},
+	".cs":    {"csharp", styleBraces},
+	".java":  {"java", styleBraces},
+	".kt":    {"kotlin", styleBraces},
+	".scala": {"scala", styleBraces},
+	".js":    {"javascript", styleBraces},
+	".jsx":   {"javascript", styleBraces},
+	".mjs":   {"javascript", styleBraces},
+	".ts":    {"typescript", styleBraces},
+	".tsx":   {"typescript", styleBraces},
+	".rs":    {"rust", styleBraces},
+	".swift": {"swift", styleBraces},
+	".php":   {"php", styleBraces},
+	".dart":  {"dart", styleBraces},
+	".py":    {"python", styleIndent},
+	".rb":    {"ruby", styleIndent},
+	".ex":    {"elixir", styleIndent},
+	".exs":   {"elixir", styleIndent},
+	".yaml":  {"yaml", styleIndent},
+	".yml":   {"yaml", styleIndent},
+}
+
+// codeSeparators son los separadores con los que se dividen los bloques que
+// superan el tamaño máximo: primero por líneas en blanco y después por líneas
+var codeSeparators = []string{"\n\n", "\n"}
+
+// CodeChunkConfig configura ChunkCode. Si MaxChunkSize es mayor que cero, los
+// bloques que lo superan (medidos con Length, en caracteres si es nil) se
+// dividen por líneas en blanco y por líneas.
+type CodeChunkConfig struct {
+	MaxChunkSize int
+	Length       func(text string) int
+}
+
+// ChunkCode divide código fuente en chunks que no cortan funciones ni tipos.
+// Los archivos Go se analizan con go/parser y producen un chunk por
+// declaración (func, método, type, const o var) con los comentarios que la
+// preceden, más uno con la cláusula package y los imports, de forma que los
+// chunks cubren todo el archivo. El resto de
+// lenguajes, o un archivo Go con errores de sintaxis, se dividen en bloques de
+// primer nivel según las llaves o la sangría, según la extensión de path.
+// El Metadata de cada chunk incluye "file", "language", "start_line" y
+// "end_line", y en Go también "kind" y "name".
+func ChunkCode(path, source string, config CodeChunkConfig) TextChunks {
+	if config.Length == nil {
+		config.Length = utf8.RuneCountInString
+	}
+
+	language, known := codeLanguages[strings.ToLower(filepath.Ext(path))]
+	var units []codeUnit
+	if language.name == "go" {
+		units = goUnits(path, source)
+	}
+	if units == nil {
+		if !known {
+			language.name = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		}
+		units = blockUnits(source, language.style, language.name == "rust")
+	}
+
+	splitter := recursiveSplitter{text: source, config: RecursiveChunkConfig{
+		ChunkSize:  config.MaxChunkSize,
+		Separators: codeSeparators,
+		Length:     config.Length,
+	}}
+	lines := newLineIndex(source)
+
+	var chunks []ChunkInfo
+	for _, unit := range units {
+		for _, s := range splitter.split(unit.span, codeSeparators) {
+			if s = trimSpan(source, s); s.end <= s.start {
+				continue
+			}
+			chunk := createChunkInfoAt(source, s.start, s.end)
+			chunk.Metadata = map[string]interface{}{
+				"file":       path,
+				"language":   language.name,
+				"start_line": lines.line(s.start),
+				"end_line":   lines.line(s.end - 1),
+			}
+			if unit.kind != "" {
+				chunk.Metadata["kind"] = unit.kind
+				chunk.Metadata["name"] = unit.name
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	return TextChunks{
+		NumChunks: len(chunks),
+		ChunkList: chunks,
+	}
+}
+
+// codeUnit es un bloque de código que se mantiene entero si cabe en un chunk
+type codeUnit struct {
+	span span
+	kind string
+	name string
+}
+
+// goUnits devuelve una unidad por declaración del archivo Go, o nil si no se
+// puede analizar
+func goUnits(path, source string) []codeUnit {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, source, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+
+	// La cabecera va desde el principio del archivo hasta el último import
+	header := codeUnit{span: span{0, offset(file.Name.End())}, kind: "package", name: file.Name.Name}
+	units := []codeUnit{header}
+
+	for _, decl := range file.Decls {
+		unit := codeUnit{span: span{offset(decl.Pos()), offset(decl.End())}}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			unit.kind, unit.name = "func", d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				unit.kind = "method"
+				unit.name = receiverName(d.Recv.List[0].Type) + "." + d.Name.Name
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				units[0].span.end = unit.span.end
+				continue
+			}
+			unit.kind, unit.name = d.Tok.String(), specNames(d.Specs)
+		}
+		units = append(units, unit)
+	}
+
+	// Cada unidad empieza donde acaba la anterior, así que los comentarios de
+	// documentación y los sueltos entre declaraciones van con la declaración
+	// siguiente. Lo que sigue a una declaración en su última línea, como un
+	// comentario, va con ella, y la última llega hasta el final del archivo.
+	for i := range units {
+		if i > 0 {
+			units[i].span.start = units[i-1].span.end
+		}
+		end := len(source)
+		if i+1 < len(units) {
+			end = min(lineEnd(source, units[i].span.end), units[i+1].span.start)
+		}
+		units[i].span.end = end
+	}
+	return units
+}
+
+// lineEnd devuelve la posición siguiente al final de la línea en la que está offset
+func lineEnd(text string, offset int) int {
+	if i := strings.IndexByte(text[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(text)
+}
+
+// receiverName devuelve el nombre del tipo receptor de un método (T para *T o T[K])
+func receiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.IndexListExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// specNames une los nombres declarados en un bloque type, const o var
+func specNames(specs []ast.Spec) string {
+	var names []string
+	for _, spec := range specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, s.Name.Name)
+		case *ast.ValueSpec:
+			for _, name := range s.Names {
+				names = append(names, name.Name)
+			}
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// blockUnits divide el código en bloques de primer nivel. Con llaves un bloque
+// termina al cerrar la llave de nivel superior o en una línea en blanco fuera
+// de cualquier llave; con sangría empieza un bloque nuevo en cada línea sin
+// sangría que sigue a una línea en blanco o sangrada. Los comentarios y
+// decoradores pegados a una declaración quedan en su mismo bloque.
+func blockUnits(source string, style codeStyle, lifetimes bool) []codeUnit {
+	var units []codeUnit
+	start := -1
+	depth := 0
+	scanner := braceScanner{lifetimes: lifetimes}
+	prevIndented, prevBlank := false, true
+
+	for _, line := range splitLines(source) {
+		text := source[line.start:line.end]
+		blank := strings.TrimSpace(text) == ""
+
+		switch style {
+		case styleBraces:
+			if blank && depth == 0 && start >= 0 {
+				units = append(units, codeUnit{span: span{start, line.start}})
+				start = -1
+			}
+			if !blank && start < 0 {
+				start = line.start
+			}
+			before := depth
+			depth = scanner.scan(text, depth)
+			if before > 0 && depth == 0 {
+				units = append(units, codeUnit{span: span{start, line.end}})
+				start = -1
+			}
+		case styleIndent:
+			indented := strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")
+			if !blank && !indented && (prevBlank || prevIndented) && !isCloser(text) && start >= 0 {
+				units = append(units, codeUnit{span: span{start, line.start}})
+				start = -1
+			}
+			if !blank && start < 0 {
+				start = line.start
+			}
+			if !blank {
+				prevIndented = indented
+			}
+			prevBlank = blank
+		}
+	}
+	if start >= 0 {
+		units = append(units, codeUnit{span: span{start, len(source)}})
+	}
+	return units
+}
+
+// isCloser indica si una línea sin sangría cierra el bloque anterior en vez de empezar uno
+func isCloser(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "end" || strings.HasPrefix(trimmed, ")") || strings.HasPrefix(trimmed, "]") || strings.HasPrefix(trimmed, "}")
+}
+
+// braceScanner cuenta la profundidad de llaves de un archivo línea a línea,
+// ignorando las que aparecen en cadenas y comentarios. Con lifetimes (Rust) la
+// comilla simple solo abre un literal de carácter, no una cadena.
+type braceScanner struct {
+	lifetimes      bool
+	inBlockComment bool
+	inRawString    bool
+}
+
+func (b *braceScanner) scan(line string, depth int) int {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case b.inBlockComment:
+			if strings.HasPrefix(line[i:], "*/") {
+				b.inBlockComment = false
+				i++
+			}
+		case b.inRawString:
+			if c == '`' {
+				b.inRawString = false
+			}
+		case strings.HasPrefix(line[i:], "//"):
+			return depth
+		case strings.HasPrefix(line[i:], "/*"):
+			b.inBlockComment = true
+			i++
+		case c == '`':
+			b.inRawString = true
+		case c == '\'' && b.lifetimes && !(i+2 < len(line) && (line[i+1] == '\\' || line[i+2] == '\'')):
+			// Lifetime como 'a: no abre ningún literal
+		case c == '"' || c == '\'':
+			// Cadena de una línea: se salta hasta la comilla de cierre
+			for i++; i < len(line) && line[i] != c; i++ {
+				if line[i] == '\\' {
+					i++
+				}
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	return depth
+}
+
+// lineIndex convierte posiciones en bytes en números de línea
+type lineIndex []int
+
+func newLineIndex(text string) lineIndex {
+	index := lineIndex{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			index = append(index, i+1)
+		}
+	}
+	return index
+}
+
+// line devuelve el número de línea, empezando en 1, de la posición indicada
+func (l lineIndex) line(offset int) int {
+	lo, hi := 0, len(l)
+	for lo+1 < hi {
+		mid := (lo + hi) / 2
+		if l[mid] <= offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo + 1
+}
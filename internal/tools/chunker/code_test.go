@@ -0,0 +1,91 @@
+package chunker
+
+import (
+	"strings"
+	"testing"
+)
+
+const goSource = `// Package ejemplo sirve para probar ChunkCode
+package ejemplo
+
+import "fmt"
+
+// Sección de constantes: este comentario no es de documentación
+
+// Max es el máximo
+const Max = 10 // comentario al final de la línea
+
+/*
+Bloque suelto entre declaraciones
+*/
+
+func Hola() {
+	fmt.Println("hola")
+}
+
+type T struct{}
+
+// String implementa fmt.Stringer
+func (t *T) String() string { return "T" }
+
+// Comentario al final del archivo
+`
+
+func TestGoUnitsCoverWholeSource(t *testing.T) {
+	units := goUnits("ejemplo.go", goSource)
+	if len(units) != 5 {
+		t.Fatalf("se esperaban 5 unidades, hay %d", len(units))
+	}
+
+	end := 0
+	for _, unit := range units {
+		if unit.span.start != end {
+			t.Errorf("la unidad %s %s empieza en %d, la anterior acaba en %d", unit.kind, unit.name, unit.span.start, end)
+		}
+		end = unit.span.end
+	}
+	if end != len(goSource) {
+		t.Errorf("las unidades acaban en %d, el archivo tiene %d bytes", end, len(goSource))
+	}
+}
+
+func TestChunkCodeKeepsLooseComments(t *testing.T) {
+	chunks := ChunkCode("ejemplo.go", goSource, CodeChunkConfig{})
+
+	want := []struct {
+		name     string
+		contains []string
+	}{
+		{"ejemplo", []string{"// Package ejemplo", `import "fmt"`}},
+		{"Max", []string{"// Sección de constantes", "// Max es el máximo", "// comentario al final de la línea"}},
+		{"Hola", []string{"Bloque suelto entre declaraciones", "func Hola()"}},
+		{"T", []string{"type T struct{}"}},
+		{"T.String", []string{"// String implementa", "// Comentario al final del archivo"}},
+	}
+	if chunks.NumChunks != len(want) {
+		t.Fatalf("se esperaban %d chunks, hay %d", len(want), chunks.NumChunks)
+	}
+	for i, w := range want {
+		chunk := chunks.ChunkList[i]
+		if chunk.Metadata["name"] != w.name {
+			t.Errorf("chunk %d: nombre %v, se esperaba %s", i, chunk.Metadata["name"], w.name)
+		}
+		for _, s := range w.contains {
+			if !strings.Contains(chunk.Text, s) {
+				t.Errorf("el chunk %s no contiene %q:\n%s", w.name, s, chunk.Text)
+			}
+		}
+	}
+
+	// Los chunks recortan los espacios, pero no deben perder ningún otro carácter
+	var joined strings.Builder
+	for _, chunk := range chunks.ChunkList {
+		joined.WriteString(chunk.Text + "\n")
+	}
+	if strings.Join(strings.Fields(joined.String()), " ") != strings.Join(strings.Fields(goSource), " ") {
+		t.Errorf("los chunks no cubren todo el archivo:\n%s", joined.String())
+	}
+	if line := chunks.ChunkList[1].Metadata["start_line"]; line != 6 {
+		t.Errorf("start_line de Max = %v, se esperaba 6", line)
+	}
+}
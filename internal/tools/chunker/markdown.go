@@ -0,0 +1,358 @@
+package chunker
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	atxHeadingRegex = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextRegex     = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fenceRegex      = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	// Un marcador sin contenido no se considera un elemento, para no confundir
+	// "-" con el subrayado de un encabezado setext
+	listItemRegex    = regexp.MustCompile(`^( {0,3})(?:[-*+]|\d{1,9}[.)])[ \t]+\S`)
+	nestedFenceRegex = regexp.MustCompile("^[ \t]*(?:(?:[-*+]|\\d{1,9}[.)])[ \t]+)?(`{3,}|~{3,})")
+	tableDelimRegex  = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+)
+
+// markdownSeparators son los separadores con los que se dividen los párrafos
+// y elementos de lista que no caben en un chunk
+var markdownSeparators = []string{"\n", ". ", "! ", "? ", " ", ""}
+
+// MarkdownChunkConfig configura ChunkMarkdown. MaxChunkSize es el tamaño
+// máximo de cada chunk medido con Length (número de caracteres si es nil); con
+// cero cada sección forma un único chunk. BreadcrumbSeparator une los
+// encabezados de la ruta (" > " por defecto).
+type MarkdownChunkConfig struct {
+	MaxChunkSize        int
+	Length              func(text string) int
+	BreadcrumbSeparator string
+}
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading
+	blockCode
+	blockTable
+	blockList
+)
+
+// markdownBlock es un bloque de primer nivel del documento. items contiene
+// los elementos de una lista, que es el único punto en el que se puede cortar,
+// y fences los bloques de código que hay dentro de ellos.
+type markdownBlock struct {
+	kind   blockKind
+	span   span
+	level  int
+	title  string
+	items  []span
+	fences []span
+}
+
+// ChunkMarkdown divide un documento Markdown respetando su estructura. Cada
+// sección empieza un chunk nuevo y sus bloques se agrupan hasta MaxChunkSize;
+// los bloques de código y las tablas nunca se cortan, aunque superen el límite,
+// las listas solo se cortan entre elementos y los párrafos demasiado largos se
+// dividen por líneas, oraciones y palabras. El Metadata de cada chunk incluye
+// "headings", con los encabezados de los que cuelga, y "breadcrumb", con
+// esos encabezados unidos (por ejemplo "Instalación > Linux").
+func ChunkMarkdown(text string, config MarkdownChunkConfig) TextChunks {
+	if config.Length == nil {
+		config.Length = utf8.RuneCountInString
+	}
+	if config.BreadcrumbSeparator == "" {
+		config.BreadcrumbSeparator = " > "
+	}
+	splitter := recursiveSplitter{text: text, config: RecursiveChunkConfig{
+		ChunkSize:  config.MaxChunkSize,
+		Separators: markdownSeparators,
+		Length:     config.Length,
+	}}
+
+	var chunks []ChunkInfo
+	// headings es la pila de encabezados de los que cuelga la sección actual
+	var headings []markdownBlock
+	var section []markdownBlock
+
+	flushSection := func() {
+		if len(section) == 0 {
+			return
+		}
+		metadata := map[string]interface{}{}
+		if len(headings) > 0 {
+			titles := make([]string, len(headings))
+			for i, heading := range headings {
+				titles[i] = heading.title
+			}
+			metadata["headings"] = titles
+			metadata["breadcrumb"] = strings.Join(titles, config.BreadcrumbSeparator)
+		}
+		for _, s := range splitter.mergeBlocks(section) {
+			if s = trimSpan(text, s); s.end > s.start {
+				chunk := createChunkInfoAt(text, s.start, s.end)
+				if len(metadata) > 0 {
+					chunk.Metadata = copyMetadata(metadata)
+				}
+				chunks = append(chunks, chunk)
+			}
+		}
+		section = nil
+	}
+
+	for _, block := range parseMarkdown(text) {
+		if block.kind == blockHeading {
+			flushSection()
+			// Un encabezado cierra los de su nivel o inferior, aunque se salten niveles
+			for len(headings) > 0 && headings[len(headings)-1].level >= block.level {
+				headings = headings[:len(headings)-1]
+			}
+			headings = append(headings, block)
+		}
+		section = append(section, block)
+	}
+	flushSection()
+
+	return TextChunks{
+		NumChunks: len(chunks),
+		ChunkList: chunks,
+	}
+}
+
+// mergeBlocks agrupa los bloques de una sección en chunks. El encabezado se une
+// al primer bloque para que no quede solo en un chunk.
+func (r *recursiveSplitter) mergeBlocks(blocks []markdownBlock) []span {
+	if len(blocks) > 1 && blocks[0].kind == blockHeading {
+		blocks[1].span.start = blocks[0].span.start
+		blocks = blocks[1:]
+	}
+
+	var chunks []span
+	var current *span
+	flush := func() {
+		if current != nil {
+			chunks = append(chunks, *current)
+			current = nil
+		}
+	}
+
+	for _, block := range blocks {
+		if r.config.ChunkSize > 0 && r.length(block.span) > r.config.ChunkSize {
+			flush()
+			switch block.kind {
+			case blockCode, blockTable:
+				chunks = append(chunks, block.span)
+			case blockList:
+				items := block.items
+				items[0].start = block.span.start
+				r.atomic = block.fences
+				chunks = append(chunks, r.merge(r.splitAtFences(items, block.fences), r.config.Separators)...)
+				r.atomic = nil
+			default:
+				chunks = append(chunks, r.split(block.span, r.config.Separators)...)
+			}
+			continue
+		}
+
+		if current != nil && (r.config.ChunkSize <= 0 || r.length(span{current.start, block.span.end}) <= r.config.ChunkSize) {
+			current.end = block.span.end
+			continue
+		}
+		flush()
+		s := block.span
+		current = &s
+	}
+	flush()
+	return chunks
+}
+
+// splitAtFences separa de los elementos que no caben en un chunk los bloques de
+// código que contienen, para que se agrupen enteros con el texto que los rodea
+func (r *recursiveSplitter) splitAtFences(items, fences []span) []span {
+	var parts []span
+	for _, item := range items {
+		if r.length(item) <= r.config.ChunkSize {
+			parts = append(parts, item)
+			continue
+		}
+		start := item.start
+		for _, fence := range fences {
+			if fence.start < item.start || fence.end > item.end {
+				continue
+			}
+			if fence.start > start {
+				parts = append(parts, span{start, fence.start})
+			}
+			parts = append(parts, fence)
+			start = fence.end
+		}
+		if start < item.end {
+			parts = append(parts, span{start, item.end})
+		}
+	}
+	return parts
+}
+
+// parseMarkdown divide el documento en bloques de primer nivel: encabezados
+// ATX y setext, bloques de código delimitados, tablas, listas y párrafos
+func parseMarkdown(text string) []markdownBlock {
+	lines := splitLines(text)
+	var blocks []markdownBlock
+
+	for i := 0; i < len(lines); {
+		line := text[lines[i].start:lines[i].end]
+		if strings.TrimSpace(line) == "" {
+			i++
+			continue
+		}
+
+		if m := atxHeadingRegex.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, markdownBlock{kind: blockHeading, span: lines[i], level: len(m[1]), title: strings.TrimSpace(m[2])})
+			i++
+			continue
+		}
+
+		if m := fenceRegex.FindStringSubmatch(line); m != nil {
+			end := closingFence(text, lines, i, m[1])
+			blocks = append(blocks, markdownBlock{kind: blockCode, span: span{lines[i].start, lines[end].end}})
+			i = end + 1
+			continue
+		}
+
+		if strings.Contains(line, "|") && i+1 < len(lines) && tableDelimRegex.MatchString(text[lines[i+1].start:lines[i+1].end]) {
+			end := i + 1
+			for end+1 < len(lines) && strings.Contains(text[lines[end+1].start:lines[end+1].end], "|") {
+				end++
+			}
+			blocks = append(blocks, markdownBlock{kind: blockTable, span: span{lines[i].start, lines[end].end}})
+			i = end + 1
+			continue
+		}
+
+		if listItemRegex.MatchString(line) {
+			block, end := parseList(text, lines, i)
+			blocks = append(blocks, block)
+			i = end + 1
+			continue
+		}
+
+		// Párrafo: líneas consecutivas hasta una línea en blanco o el inicio de otro bloque
+		end := i
+		for end+1 < len(lines) {
+			next := text[lines[end+1].start:lines[end+1].end]
+			if strings.TrimSpace(next) == "" || atxHeadingRegex.MatchString(next) || fenceRegex.MatchString(next) || listItemRegex.MatchString(next) {
+				break
+			}
+			if end == i && setextRegex.MatchString(next) {
+				level := 1
+				if strings.Contains(next, "-") {
+					level = 2
+				}
+				blocks = append(blocks, markdownBlock{kind: blockHeading, span: span{lines[i].start, lines[end+1].end}, level: level, title: strings.TrimSpace(line)})
+				end = -1
+				i += 2
+				break
+			}
+			end++
+		}
+		if end < 0 {
+			continue
+		}
+		blocks = append(blocks, markdownBlock{kind: blockParagraph, span: span{lines[i].start, lines[end].end}})
+		i = end + 1
+	}
+	return blocks
+}
+
+// closingFence devuelve la línea que cierra el bloque de código abierto en la
+// línea start, o la última del documento si no se cierra
+func closingFence(text string, lines []span, start int, fence string) int {
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimSpace(text[lines[i].start:lines[i].end])
+		if strings.HasPrefix(line, fence) && strings.Trim(line, fence[:1]) == "" {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// parseList lee una lista que empieza en la línea start y devuelve el bloque
+// con sus elementos y la última línea que ocupa. Los elementos anidados y las
+// líneas de continuación pertenecen al elemento en el que aparecen.
+func parseList(text string, lines []span, start int) (markdownBlock, int) {
+	indent := len(listItemRegex.FindStringSubmatch(text[lines[start].start:lines[start].end])[1])
+	block := markdownBlock{kind: blockList}
+	end := start
+
+	for i := start; i < len(lines); i++ {
+		line := text[lines[i].start:lines[i].end]
+		if strings.TrimSpace(line) == "" {
+			// Una línea en blanco solo continúa la lista si sigue un elemento o una línea sangrada
+			if i+1 >= len(lines) {
+				break
+			}
+			next := text[lines[i+1].start:lines[i+1].end]
+			if !listItemRegex.MatchString(next) && !isIndented(next) {
+				break
+			}
+			continue
+		}
+
+		m := listItemRegex.FindStringSubmatch(line)
+		switch {
+		case m != nil && len(m[1]) <= indent:
+			block.items = append(block.items, lines[i])
+		case m != nil || isIndented(line):
+		case i > start && strings.TrimSpace(text[lines[i-1].start:lines[i-1].end]) != "" &&
+			!atxHeadingRegex.MatchString(line) && !fenceRegex.MatchString(line):
+			// Línea de continuación sin sangría del elemento anterior
+		default:
+			return finishList(block), end
+		}
+		// Un bloque de código forma parte del elemento entero, aunque contenga
+		// líneas sin sangría o que parecen elementos de la lista
+		if fence := nestedFenceRegex.FindStringSubmatch(line); fence != nil {
+			closing := closingFence(text, lines, i, fence[1])
+			block.fences = append(block.fences, span{lines[i].start, lines[closing].end})
+			i = closing
+		}
+		block.items[len(block.items)-1].end = lines[i].end
+		end = i
+	}
+	return finishList(block), end
+}
+
+func finishList(block markdownBlock) markdownBlock {
+	block.span = span{block.items[0].start, block.items[len(block.items)-1].end}
+	return block
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")
+}
+
+// splitLines devuelve la posición de cada línea del texto, sin el salto de línea
+func splitLines(text string) []span {
+	var lines []span
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			lines = append(lines, span{start, len(text)})
+			break
+		}
+		lines = append(lines, span{start, start + end})
+		start += end + 1
+	}
+	return lines
+}
+
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
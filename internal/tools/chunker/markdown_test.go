@@ -0,0 +1,77 @@
+package chunker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkMarkdownBreadcrumbSkippingLevels(t *testing.T) {
+	text := "# A\n\n### X\n\nx body\n\n### Y\n\ny body\n\n## B\n\nb body\n\n#### Z\n\nz body\n\n# C\n\nc body\n"
+
+	chunks := ChunkMarkdown(text, MarkdownChunkConfig{})
+
+	want := []struct {
+		text     string
+		headings []string
+	}{
+		{"# A", []string{"A"}},
+		{"### X\n\nx body", []string{"A", "X"}},
+		{"### Y\n\ny body", []string{"A", "Y"}},
+		{"## B\n\nb body", []string{"A", "B"}},
+		{"#### Z\n\nz body", []string{"A", "B", "Z"}},
+		{"# C\n\nc body", []string{"C"}},
+	}
+	if chunks.NumChunks != len(want) {
+		t.Fatalf("se esperaban %d chunks, hay %d: %+v", len(want), chunks.NumChunks, chunks.ChunkList)
+	}
+	for i, w := range want {
+		chunk := chunks.ChunkList[i]
+		if chunk.Text != w.text {
+			t.Errorf("chunk %d: texto %q, se esperaba %q", i, chunk.Text, w.text)
+		}
+		if !reflect.DeepEqual(chunk.Metadata["headings"], w.headings) {
+			t.Errorf("chunk %d: encabezados %v, se esperaba %v", i, chunk.Metadata["headings"], w.headings)
+		}
+	}
+	if got := chunks.ChunkList[2].Metadata["breadcrumb"]; got != "A > Y" {
+		t.Errorf("breadcrumb de Y = %q, se esperaba %q", got, "A > Y")
+	}
+}
+
+func TestChunkMarkdownKeepsFencesInListItems(t *testing.T) {
+	fence := "```sh\n  apt-get update\n- no es un elemento\n\n  apt-get install -y git\n  ```"
+	text := "# Pasos\n\n- Instala las dependencias con el gestor de paquetes del sistema.\n\n  " + fence +
+		"\n\n  Después comprueba la versión instalada.\n- Configura el proyecto.\n"
+
+	chunks := ChunkMarkdown(text, MarkdownChunkConfig{MaxChunkSize: 60})
+
+	found := false
+	for _, chunk := range chunks.ChunkList {
+		if text[chunk.Start:chunk.End] != chunk.Text {
+			t.Errorf("posiciones incorrectas para %q", chunk.Text)
+		}
+		if strings.Contains(chunk.Text, fence) {
+			found = true
+		} else if strings.Contains(chunk.Text, "apt-get") {
+			t.Errorf("el bloque de código se cortó: %q", chunk.Text)
+		}
+	}
+	if !found {
+		t.Errorf("ningún chunk contiene el bloque de código entero: %+v", chunks.ChunkList)
+	}
+	if last := chunks.ChunkList[chunks.NumChunks-1].Text; last != "- Configura el proyecto." {
+		t.Errorf("la línea del bloque de código no debe empezar un elemento; último chunk %q", last)
+	}
+}
+
+func TestChunkMarkdownSetextUnderlineIsNotListItem(t *testing.T) {
+	chunks := ChunkMarkdown("Opciones\n-\n\nTexto de la sección.\n\n- uno\n-\n", MarkdownChunkConfig{})
+
+	if chunks.NumChunks != 1 {
+		t.Fatalf("se esperaba 1 chunk, hay %d: %+v", chunks.NumChunks, chunks.ChunkList)
+	}
+	if got := chunks.ChunkList[0].Metadata["breadcrumb"]; got != "Opciones" {
+		t.Errorf("\"-\" bajo una línea debe ser un encabezado setext, breadcrumb %q", got)
+	}
+}
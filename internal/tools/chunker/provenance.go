@@ -0,0 +1,102 @@
+package chunker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codigogp/letsgollm/internal/tools/loader"
+)
+
+// WithProvenance completa la procedencia de los chunks obtenidos del
+// contenido de doc: origen, índice, posiciones en bytes y en runas, página
+// en los PDF, hash SHA-256 del texto e ID. Los chunks sin posiciones se buscan
+// en el contenido a partir del anterior; si no aparecen (porque el chunker
+// modificó el texto) sus posiciones y página quedan a cero.
+//
+// El ID depende del origen, del hash y de cuántas veces se repite ese mismo
+// texto antes en el documento, así que no cambia al reindexar un documento
+// aunque se añada o quite texto en otras partes.
+func WithProvenance(chunks TextChunks, doc *loader.TextDocument) TextChunks {
+	content := doc.Content
+	result := make([]ChunkInfo, len(chunks.ChunkList))
+	occurrences := map[string]int{}
+	cursor := 0
+	runeCursor := runeOffset{}
+
+	for i, chunk := range chunks.ChunkList {
+		chunk.Source = doc.URLOrPath
+		chunk.Index = i
+		sum := sha256.Sum256([]byte(chunk.Text))
+		chunk.Hash = hex.EncodeToString(sum[:])
+		chunk.ID = chunkID(chunk.Source, chunk.Hash, occurrences[chunk.Hash])
+		occurrences[chunk.Hash]++
+
+		located := chunk.End > 0 && chunk.End <= len(content) && content[chunk.Start:chunk.End] == chunk.Text
+		if !located && chunk.Text != "" {
+			if idx := strings.Index(content[cursor:], chunk.Text); idx >= 0 {
+				chunk.Start = cursor + idx
+				chunk.End = chunk.Start + len(chunk.Text)
+				located = true
+			}
+		}
+
+		if located {
+			// Los chunks pueden solaparse, así que el siguiente se busca justo
+			// después del inicio de este; así un texto repetido no vuelve a
+			// encontrar la misma aparición
+			cursor = min(chunk.Start+1, chunk.End)
+			chunk.RuneStart = runeCursor.at(content, chunk.Start)
+			chunk.RuneEnd = chunk.RuneStart + utf8.RuneCountInString(chunk.Text)
+			chunk.Page = doc.PageAt(chunk.Start)
+		}
+		result[i] = chunk
+	}
+
+	return TextChunks{
+		NumChunks: len(result),
+		ChunkList: result,
+	}
+}
+
+// StoreMetadata devuelve el Metadata del chunk junto con su procedencia, con
+// el formato que se guarda en VectorDatabase
+func (c ChunkInfo) StoreMetadata() map[string]interface{} {
+	metadata := copyMetadata(c.Metadata)
+	metadata["chunk_id"] = c.ID
+	metadata["source"] = c.Source
+	metadata["chunk_index"] = c.Index
+	metadata["byte_start"] = c.Start
+	metadata["byte_end"] = c.End
+	metadata["rune_start"] = c.RuneStart
+	metadata["rune_end"] = c.RuneEnd
+	metadata["hash"] = c.Hash
+	if c.Page > 0 {
+		metadata["page"] = c.Page
+	}
+	return metadata
+}
+
+// chunkID calcula el identificador estable de un chunk
+func chunkID(source, hash string, occurrence int) string {
+	sum := sha256.Sum256([]byte(source + "\x00" + hash + "\x00" + strconv.Itoa(occurrence)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// runeOffset convierte posiciones en bytes en posiciones en runas, contando
+// solo desde la última posición consultada cuando se avanza
+type runeOffset struct {
+	byteOffset int
+	runeOffset int
+}
+
+func (r *runeOffset) at(text string, offset int) int {
+	if offset < r.byteOffset {
+		r.byteOffset, r.runeOffset = 0, 0
+	}
+	r.runeOffset += utf8.RuneCountInString(text[r.byteOffset:offset])
+	r.byteOffset = offset
+	return r.runeOffset
+}
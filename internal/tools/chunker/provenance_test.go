@@ -0,0 +1,37 @@
+package chunker
+
+import (
+	"testing"
+
+	"github.com/codigogp/letsgollm/internal/tools/loader"
+)
+
+func TestWithProvenanceLocatesRepeatedText(t *testing.T) {
+	doc := &loader.TextDocument{Content: "Hola. Hola. Adiós.", URLOrPath: "saludos.txt"}
+	// Chunks sin posiciones, como los de un chunker que no las calcula
+	chunks := TextChunks{NumChunks: 3, ChunkList: []ChunkInfo{{Text: "Hola."}, {Text: "Hola."}, {Text: "Adiós."}}}
+
+	result := WithProvenance(chunks, doc)
+
+	want := []struct{ start, end, runeStart, runeEnd int }{
+		{0, 5, 0, 5},
+		{6, 11, 6, 11},
+		{12, 19, 12, 18},
+	}
+	for i, w := range want {
+		chunk := result.ChunkList[i]
+		if chunk.Start != w.start || chunk.End != w.end || chunk.RuneStart != w.runeStart || chunk.RuneEnd != w.runeEnd {
+			t.Errorf("chunk %d: posiciones %d-%d (runas %d-%d), se esperaba %d-%d (runas %d-%d)",
+				i, chunk.Start, chunk.End, chunk.RuneStart, chunk.RuneEnd, w.start, w.end, w.runeStart, w.runeEnd)
+		}
+		if chunk.Source != "saludos.txt" || chunk.Index != i {
+			t.Errorf("chunk %d: procedencia inesperada %q %d", i, chunk.Source, chunk.Index)
+		}
+	}
+
+	// El mismo texto tiene el mismo hash pero un ID distinto en cada aparición
+	first, second := result.ChunkList[0], result.ChunkList[1]
+	if first.Hash != second.Hash || first.ID == second.ID {
+		t.Errorf("hash o ID inesperados: %s %s / %s %s", first.Hash, first.ID, second.Hash, second.ID)
+	}
+}
@@ -0,0 +1,158 @@
+package chunker
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultSeparators son los separadores que usa ChunkRecursively por defecto,
+// de la unidad natural más grande a la más pequeña: secciones, párrafos,
+// líneas, oraciones y palabras. La cadena vacía divide en caracteres.
+var DefaultSeparators = []string{"\n\n\n", "\n\n", "\n", ". ", "! ", "? ", " ", ""}
+
+// RecursiveChunkConfig configura ChunkRecursively. ChunkSize es el tamaño
+// máximo de cada chunk y Overlap cuánto se repite del chunk anterior, ambos
+// medidos con Length (número de caracteres si es nil; un TokenCounter permite
+// medir en tokens). Separators sustituye a DefaultSeparators. Un Overlap mayor
+// que la mitad de ChunkSize se reduce a esa mitad, para que cada chunk aporte
+// al menos tanto texto nuevo como el que repite.
+type RecursiveChunkConfig struct {
+	ChunkSize  int
+	Overlap    int
+	Separators []string
+	Length     func(text string) int
+}
+
+// span es un fragmento del texto original delimitado por sus posiciones en bytes
+type span struct {
+	start, end int
+}
+
+// ChunkRecursively divide el texto con el primer separador de la lista que
+// aparece en él y vuelve a dividir, con los separadores siguientes, solo los
+// fragmentos que siguen superando ChunkSize. Los fragmentos pequeños se
+// agrupan hasta llenar cada chunk, de modo que se conservan las unidades
+// naturales más grandes posibles. Si la lista de separadores no termina en ""
+// algún chunk puede quedar por encima del límite.
+func ChunkRecursively(text string, config RecursiveChunkConfig) TextChunks {
+	splitter := recursiveSplitter{text: text, config: config}
+	if splitter.config.Separators == nil {
+		splitter.config.Separators = DefaultSeparators
+	}
+	if splitter.config.Length == nil {
+		splitter.config.Length = utf8.RuneCountInString
+	}
+	if splitter.config.ChunkSize > 0 && splitter.config.Overlap > splitter.config.ChunkSize/2 {
+		splitter.config.Overlap = splitter.config.ChunkSize / 2
+	}
+
+	var chunks []ChunkInfo
+	for _, s := range splitter.split(span{0, len(text)}, splitter.config.Separators) {
+		if s = trimSpan(text, s); s.end > s.start {
+			chunks = append(chunks, createChunkInfoAt(text, s.start, s.end))
+		}
+	}
+
+	return TextChunks{
+		NumChunks: len(chunks),
+		ChunkList: chunks,
+	}
+}
+
+// recursiveSplitter divide el texto según config. atomic son fragmentos que
+// no se cortan aunque superen ChunkSize, como los bloques de código de Markdown.
+type recursiveSplitter struct {
+	text   string
+	config RecursiveChunkConfig
+	atomic []span
+}
+
+func (r *recursiveSplitter) length(s span) int {
+	return r.config.Length(r.text[s.start:s.end])
+}
+
+// split divide s con el primer separador que aparece en él y agrupa las partes
+func (r *recursiveSplitter) split(s span, separators []string) []span {
+	if r.config.ChunkSize <= 0 || r.length(s) <= r.config.ChunkSize {
+		return []span{s}
+	}
+	for _, atomic := range r.atomic {
+		if s == atomic {
+			return []span{s}
+		}
+	}
+
+	for i, separator := range separators {
+		if separator != "" && !strings.Contains(r.text[s.start:s.end], separator) {
+			continue
+		}
+		return r.merge(splitSpan(r.text, s, separator), separators[i+1:])
+	}
+	return []span{s}
+}
+
+// merge agrupa partes consecutivas mientras quepan en ChunkSize; las que no
+// caben por sí solas se dividen con los separadores restantes
+func (r *recursiveSplitter) merge(parts []span, separators []string) []span {
+	var chunks []span
+	var current []span
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		chunks = append(chunks, span{current[0].start, current[len(current)-1].end})
+		// Se conservan las últimas partes como solapamiento del chunk siguiente
+		for len(current) > 0 && r.length(span{current[0].start, current[len(current)-1].end}) > r.config.Overlap {
+			current = current[1:]
+		}
+	}
+
+	for _, part := range parts {
+		if r.length(part) > r.config.ChunkSize {
+			flush()
+			current = nil
+			chunks = append(chunks, r.split(part, separators)...)
+			continue
+		}
+		if len(current) > 0 && r.length(span{current[0].start, part.end}) > r.config.ChunkSize {
+			flush()
+			for len(current) > 0 && r.length(span{current[0].start, part.end}) > r.config.ChunkSize {
+				current = current[1:]
+			}
+		}
+		current = append(current, part)
+	}
+	flush()
+	return chunks
+}
+
+// splitSpan divide s tras cada aparición del separador, que queda al final de
+// la parte anterior para que las partes cubran todo el texto. El separador
+// vacío divide en caracteres.
+func splitSpan(text string, s span, separator string) []span {
+	var parts []span
+	start := s.start
+	for start < s.end {
+		end := s.end
+		if separator == "" {
+			_, size := utf8.DecodeRuneInString(text[start:s.end])
+			end = start + size
+		} else if i := strings.Index(text[start:s.end], separator); i >= 0 {
+			end = start + i + len(separator)
+		}
+		parts = append(parts, span{start, end})
+		start = end
+	}
+	return parts
+}
+
+// trimSpan ajusta s para excluir los espacios del principio y del final
+func trimSpan(text string, s span) span {
+	chunk := text[s.start:s.end]
+	trimmed := strings.TrimLeftFunc(chunk, unicode.IsSpace)
+	s.start += len(chunk) - len(trimmed)
+	s.end = s.start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+	return s
+}
@@ -0,0 +1,68 @@
+package chunker
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkRecursively(t *testing.T) {
+	text := "El gato duerme. El perro ladra.\n\nLa lluvia cae sobre el tejado y el viento sopla."
+
+	cases := []struct {
+		name   string
+		config RecursiveChunkConfig
+		want   []string
+	}{
+		{
+			name:   "párrafos y oraciones",
+			config: RecursiveChunkConfig{ChunkSize: 40},
+			want:   []string{"El gato duerme. El perro ladra.", "La lluvia cae sobre el tejado y el", "viento sopla."},
+		},
+		{
+			name:   "palabras",
+			config: RecursiveChunkConfig{ChunkSize: 20},
+			want:   []string{"El gato duerme.", "El perro ladra.", "La lluvia cae sobre", "el tejado y el", "viento sopla."},
+		},
+		{
+			name:   "con solapamiento",
+			config: RecursiveChunkConfig{ChunkSize: 20, Overlap: 8},
+			want:   []string{"El gato duerme.", "El perro ladra.", "La lluvia cae sobre", "sobre el tejado y", "y el viento sopla."},
+		},
+		{
+			name:   "solapamiento mayor que el chunk",
+			config: RecursiveChunkConfig{ChunkSize: 20, Overlap: 50},
+			want:   []string{"El gato duerme.", "El perro ladra.", "La lluvia cae sobre", "cae sobre el tejado", "el tejado y el", "y el viento sopla."},
+		},
+		{
+			name:   "separadores propios",
+			config: RecursiveChunkConfig{ChunkSize: 10, Separators: []string{" "}},
+			want:   []string{"El gato", "duerme.", "El perro", "ladra.\n\nLa", "lluvia", "cae sobre", "el tejado", "y el", "viento", "sopla."},
+		},
+		{
+			name:   "sin límite",
+			config: RecursiveChunkConfig{},
+			want:   []string{text},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			chunks := ChunkRecursively(text, tc.config)
+
+			var got []string
+			for _, chunk := range chunks.ChunkList {
+				if text[chunk.Start:chunk.End] != chunk.Text {
+					t.Errorf("posiciones [%d:%d] incorrectas para %q", chunk.Start, chunk.End, chunk.Text)
+				}
+				if tc.config.ChunkSize > 0 && utf8.RuneCountInString(chunk.Text) > tc.config.ChunkSize {
+					t.Errorf("%q supera el tamaño máximo", chunk.Text)
+				}
+				got = append(got, chunk.Text)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("chunks %q, se esperaba %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package chunker
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sentenceEndRegex localiza el final de cada oración: la puntuación y los espacios que la siguen
+var sentenceEndRegex = regexp.MustCompile(`[.!?]+\s+`)
+
+// lexicalDimensions es el tamaño de los vectores de la representación léxica por defecto
+const lexicalDimensions = 256
+
+// EmbeddingFunc genera un embedding por cada texto, en el mismo orden. El
+// método Embed de un llm.Embedder es una EmbeddingFunc.
+type EmbeddingFunc func(ctx context.Context, texts []string) ([][]float64, error)
+
+// BreakpointMode indica cómo se calcula a partir de las distancias entre
+// oraciones consecutivas el umbral que marca un cambio de tema
+type BreakpointMode int
+
+const (
+	// BreakpointPercentile corta donde la distancia supera el percentil Threshold (95 por defecto)
+	BreakpointPercentile BreakpointMode = iota
+	// BreakpointStdDev corta donde la distancia supera la media en Threshold desviaciones típicas (3 por defecto)
+	BreakpointStdDev
+	// BreakpointIQR corta donde la distancia supera el tercer cuartil en Threshold veces el rango intercuartílico (1.5 por defecto)
+	BreakpointIQR
+)
+
+// SemanticChunkConfig configura ChunkSemantically. Embed genera los embeddings
+// (si es nil se usa una representación léxica basada en las palabras de cada
+// oración). BufferSize es el número de oraciones vecinas que se añaden a cada
+// una antes de calcular su embedding (1 por defecto). MinChunkSize y
+// MaxChunkSize limitan el tamaño de los chunks medido con Length (número de
+// caracteres si es nil); cero desactiva el límite.
+type SemanticChunkConfig struct {
+	Embed        EmbeddingFunc
+	Mode         BreakpointMode
+	Threshold    float64
+	BufferSize   int
+	MinChunkSize int
+	MaxChunkSize int
+	Length       func(text string) int
+}
+
+// ChunkSemantically divide el texto en oraciones y corta donde la distancia
+// coseno entre los embeddings de oraciones consecutivas supera el umbral, es
+// decir, donde cambia el tema. Los chunks que superan MaxChunkSize se vuelven
+// a cortar por su mayor distancia interna y los menores que MinChunkSize se
+// unen al vecino más parecido.
+func ChunkSemantically(ctx context.Context, text string, config SemanticChunkConfig) (TextChunks, error) {
+	if config.Embed == nil {
+		config.Embed = lexicalEmbeddings
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1
+	}
+	if config.Length == nil {
+		config.Length = utf8.RuneCountInString
+	}
+
+	sentences := sentenceSpans(text)
+	if len(sentences) == 0 {
+		return TextChunks{}, nil
+	}
+
+	var distances []float64
+	if len(sentences) > 1 {
+		embeddings, err := config.Embed(ctx, combineSentences(text, sentences, config.BufferSize))
+		if err != nil {
+			return TextChunks{}, fmt.Errorf("error al generar los embeddings: %w", err)
+		}
+		if len(embeddings) != len(sentences) {
+			return TextChunks{}, fmt.Errorf("se esperaban %d embeddings y se recibieron %d", len(sentences), len(embeddings))
+		}
+		distances = cosineDistances(embeddings)
+	}
+
+	grouper := semanticGrouper{text: text, sentences: sentences, distances: distances, config: config}
+	groups := grouper.breakpoints()
+	groups = grouper.enforceMax(groups)
+	groups = grouper.enforceMin(groups)
+
+	chunks := make([]ChunkInfo, 0, len(groups))
+	for _, g := range groups {
+		chunks = append(chunks, createChunkInfoAt(text, sentences[g.start].start, sentences[g.end-1].end))
+	}
+
+	return TextChunks{
+		NumChunks: len(chunks),
+		ChunkList: chunks,
+	}, nil
+}
+
+// semanticGrouper agrupa oraciones consecutivas. Cada grupo es un rango
+// [start, end) de índices de oración y distances[i] es la distancia entre
+// las oraciones i e i+1.
+type semanticGrouper struct {
+	text      string
+	sentences []span
+	distances []float64
+	config    SemanticChunkConfig
+}
+
+func (g *semanticGrouper) size(group span) int {
+	return g.config.Length(g.text[g.sentences[group.start].start:g.sentences[group.end-1].end])
+}
+
+// breakpoints corta tras cada oración cuya distancia con la siguiente supera el umbral
+func (g *semanticGrouper) breakpoints() []span {
+	var groups []span
+	start := 0
+	if len(g.distances) > 0 {
+		threshold := breakpointThreshold(g.distances, g.config.Mode, g.config.Threshold)
+		for i, distance := range g.distances {
+			if distance > threshold {
+				groups = append(groups, span{start, i + 1})
+				start = i + 1
+			}
+		}
+	}
+	return append(groups, span{start, len(g.sentences)})
+}
+
+// enforceMax divide los grupos demasiado grandes por su mayor distancia interna
+func (g *semanticGrouper) enforceMax(groups []span) []span {
+	if g.config.MaxChunkSize <= 0 {
+		return groups
+	}
+
+	var result []span
+	for len(groups) > 0 {
+		group := groups[0]
+		groups = groups[1:]
+		if group.end-group.start == 1 || g.size(group) <= g.config.MaxChunkSize {
+			result = append(result, group)
+			continue
+		}
+
+		cut := group.start
+		for i := group.start + 1; i < group.end-1; i++ {
+			if g.distances[i] > g.distances[cut] {
+				cut = i
+			}
+		}
+		groups = append([]span{{group.start, cut + 1}, {cut + 1, group.end}}, groups...)
+	}
+	return result
+}
+
+// enforceMin une cada grupo demasiado pequeño con el vecino al que más se
+// parece, siempre que el resultado no supere MaxChunkSize
+func (g *semanticGrouper) enforceMin(groups []span) []span {
+	if g.config.MinChunkSize <= 0 {
+		return groups
+	}
+
+	fits := func(group span) bool {
+		return g.config.MaxChunkSize <= 0 || g.size(group) <= g.config.MaxChunkSize
+	}
+
+	for merged := true; merged && len(groups) > 1; {
+		merged = false
+		for i, group := range groups {
+			if g.size(group) >= g.config.MinChunkSize {
+				continue
+			}
+
+			// La distancia en la frontera indica a qué vecino se parece más
+			left, right := math.Inf(1), math.Inf(1)
+			if i > 0 && fits(span{groups[i-1].start, group.end}) {
+				left = g.distances[group.start-1]
+			}
+			if i+1 < len(groups) && fits(span{group.start, groups[i+1].end}) {
+				right = g.distances[group.end-1]
+			}
+
+			switch {
+			case math.IsInf(left, 1) && math.IsInf(right, 1):
+				continue
+			case left <= right:
+				groups[i-1].end = group.end
+				groups = append(groups[:i], groups[i+1:]...)
+			default:
+				groups[i+1].start = group.start
+				groups = append(groups[:i], groups[i+1:]...)
+			}
+			merged = true
+			break
+		}
+	}
+	return groups
+}
+
+// breakpointThreshold calcula el umbral de distancia según el modo indicado
+func breakpointThreshold(distances []float64, mode BreakpointMode, amount float64) float64 {
+	sorted := append([]float64(nil), distances...)
+	sort.Float64s(sorted)
+
+	switch mode {
+	case BreakpointStdDev:
+		if amount == 0 {
+			amount = 3
+		}
+		mean := 0.0
+		for _, d := range distances {
+			mean += d
+		}
+		mean /= float64(len(distances))
+		variance := 0.0
+		for _, d := range distances {
+			variance += (d - mean) * (d - mean)
+		}
+		return mean + amount*math.Sqrt(variance/float64(len(distances)))
+	case BreakpointIQR:
+		if amount == 0 {
+			amount = 1.5
+		}
+		q1, q3 := percentile(sorted, 25), percentile(sorted, 75)
+		return q3 + amount*(q3-q1)
+	default:
+		if amount == 0 {
+			amount = 95
+		}
+		return percentile(sorted, amount)
+	}
+}
+
+// percentile devuelve el percentil p (0-100) de valores ordenados, interpolando entre vecinos
+func percentile(sorted []float64, p float64) float64 {
+	p = math.Max(0, math.Min(100, p))
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// sentenceSpans divide el texto en oraciones conservando su puntuación
+func sentenceSpans(text string) []span {
+	var sentences []span
+	start := 0
+	for _, match := range sentenceEndRegex.FindAllStringIndex(text, -1) {
+		end := match[0] + len(strings.TrimRightFunc(text[match[0]:match[1]], unicode.IsSpace))
+		if s := trimSpan(text, span{start, end}); s.end > s.start {
+			sentences = append(sentences, s)
+		}
+		start = match[1]
+	}
+	if s := trimSpan(text, span{start, len(text)}); s.end > s.start {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// combineSentences une cada oración con sus buffer vecinas a cada lado para
+// que los embeddings sean menos ruidosos
+func combineSentences(text string, sentences []span, buffer int) []string {
+	combined := make([]string, len(sentences))
+	for i := range sentences {
+		from := max(0, i-buffer)
+		to := min(len(sentences)-1, i+buffer)
+		combined[i] = text[sentences[from].start:sentences[to].end]
+	}
+	return combined
+}
+
+// cosineDistances devuelve 1 - similitud coseno entre cada embedding y el siguiente
+func cosineDistances(vectors [][]float64) []float64 {
+	distances := make([]float64, len(vectors)-1)
+	for i := 0; i < len(vectors)-1; i++ {
+		distances[i] = 1 - cosineSimilarity(vectors[i], vectors[i+1])
+	}
+	return distances
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	dot := 0.0
+	normA := 0.0
+	normB := 0.0
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// lexicalEmbeddings es la EmbeddingFunc por defecto: cuenta las palabras de
+// cada texto en un vector de tamaño fijo, de modo que la similitud mide el
+// vocabulario compartido. No necesita ningún modelo, pero un Embedder real
+// detecta mucho mejor los cambios de tema.
+func lexicalEmbeddings(_ context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vector := make([]float64, lexicalDimensions)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, word := range words {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			vector[h.Sum32()%lexicalDimensions]++
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
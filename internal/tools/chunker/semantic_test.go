@@ -0,0 +1,116 @@
+package chunker
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// semanticText tiene seis oraciones; angleEmbeddings las coloca en el plano
+// de modo que las distancias entre vecinas son, en orden, 0.005, 0.020,
+// 0.638, 0.045 y 0.175
+const semanticText = "Uno. Dos. Tres. Cuatro. Cinco. Seis."
+
+var semanticAngles = []float64{0, 0.1, 0.3, 1.5, 1.8, 2.4}
+
+// angleEmbeddings devuelve un vector unitario por oración según su posición
+type angleEmbeddings struct{}
+
+func (angleEmbeddings) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i := range texts {
+		vectors[i] = []float64{math.Cos(semanticAngles[i]), math.Sin(semanticAngles[i])}
+	}
+	return vectors, nil
+}
+
+func (angleEmbeddings) Dimensions() int { return 2 }
+
+func TestChunkSemantically(t *testing.T) {
+	cases := []struct {
+		name   string
+		config SemanticChunkConfig
+		want   []string
+	}{
+		{
+			name:   "percentil por defecto",
+			config: SemanticChunkConfig{},
+			want:   []string{"Uno. Dos. Tres.", "Cuatro. Cinco. Seis."},
+		},
+		{
+			name:   "percentil 50",
+			config: SemanticChunkConfig{Threshold: 50},
+			want:   []string{"Uno. Dos. Tres.", "Cuatro. Cinco.", "Seis."},
+		},
+		{
+			name:   "desviación típica por defecto",
+			config: SemanticChunkConfig{Mode: BreakpointStdDev},
+			want:   []string{semanticText},
+		},
+		{
+			name:   "una desviación típica",
+			config: SemanticChunkConfig{Mode: BreakpointStdDev, Threshold: 1},
+			want:   []string{"Uno. Dos. Tres.", "Cuatro. Cinco. Seis."},
+		},
+		{
+			name:   "rango intercuartílico",
+			config: SemanticChunkConfig{Mode: BreakpointIQR},
+			want:   []string{"Uno. Dos. Tres.", "Cuatro. Cinco. Seis."},
+		},
+		{
+			name:   "tamaño máximo",
+			config: SemanticChunkConfig{MaxChunkSize: 15},
+			want:   []string{"Uno. Dos. Tres.", "Cuatro. Cinco.", "Seis."},
+		},
+		{
+			name:   "tamaño mínimo",
+			config: SemanticChunkConfig{Threshold: 50, MinChunkSize: 6},
+			want:   []string{"Uno. Dos. Tres.", "Cuatro. Cinco. Seis."},
+		},
+		{
+			name:   "el mínimo no supera el máximo",
+			config: SemanticChunkConfig{Threshold: 50, MinChunkSize: 6, MaxChunkSize: 15},
+			want:   []string{"Uno. Dos. Tres.", "Cuatro. Cinco.", "Seis."},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Embed = angleEmbeddings{}.Embed
+			chunks, err := ChunkSemantically(context.Background(), semanticText, tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chunkTexts(t, semanticText, chunks); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("chunks %q, se esperaba %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChunkBySemanticsWithEmbedderZeroThreshold(t *testing.T) {
+	chunks, err := ChunkBySemanticsWithEmbedder(context.Background(), semanticText, angleEmbeddings{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// El percentil 0 corta en todas las distancias salvo la mínima
+	want := []string{"Uno. Dos.", "Tres.", "Cuatro.", "Cinco.", "Seis."}
+	if got := chunkTexts(t, semanticText, chunks); !reflect.DeepEqual(got, want) {
+		t.Errorf("chunks %q, se esperaba %q", got, want)
+	}
+}
+
+// chunkTexts devuelve el texto de cada chunk comprobando sus posiciones
+func chunkTexts(t *testing.T, text string, chunks TextChunks) []string {
+	t.Helper()
+	var texts []string
+	for _, chunk := range chunks.ChunkList {
+		if text[chunk.Start:chunk.End] != chunk.Text {
+			t.Errorf("posiciones [%d:%d] incorrectas para %q", chunk.Start, chunk.End, chunk.Text)
+		}
+		texts = append(texts, chunk.Text)
+	}
+	return texts
+}
@@ -0,0 +1,261 @@
+package chunker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// paragraphRegex localiza la separación entre párrafos: una línea en blanco
+var paragraphRegex = regexp.MustCompile(`\n\s*\n`)
+
+const (
+	// DefaultStreamReadSize es el número de bytes que ChunkStream lee cada vez
+	DefaultStreamReadSize = 64 * 1024
+	// DefaultStreamMaxUnitSize es el tamaño máximo en bytes de una oración o un
+	// párrafo en ChunkStream si MaxChunkSize es cero
+	DefaultStreamMaxUnitSize = 1024 * 1024
+)
+
+// StreamStrategy indica cómo divide ChunkStream el texto
+type StreamStrategy int
+
+const (
+	// StreamByMaxChunkSize corta el texto en bloques de MaxChunkSize bytes o, con
+	// PreserveSentenceStructure, agrupa oraciones hasta ese tamaño
+	StreamByMaxChunkSize StreamStrategy = iota
+	// StreamBySentences produce un chunk por oración
+	StreamBySentences
+	// StreamByParagraphs produce un chunk por párrafo
+	StreamByParagraphs
+)
+
+// StreamChunkConfig configura ChunkStream. MaxChunkSize se mide en bytes: en
+// StreamByMaxChunkSize es el tamaño de cada chunk y en el resto de estrategias
+// el tamaño a partir del cual se corta una oración o un párrafo
+// (DefaultStreamMaxUnitSize si es cero). ReadSize es el número de bytes que se
+// leen cada vez (DefaultStreamReadSize si es cero).
+type StreamChunkConfig struct {
+	Strategy                  StreamStrategy
+	MaxChunkSize              int
+	PreserveSentenceStructure bool
+	ReadSize                  int
+}
+
+// ChunkEvent es cada uno de los valores que envía ChunkStream. Si la lectura
+// falla, el último evento contiene el error en Err.
+type ChunkEvent struct {
+	Chunk ChunkInfo
+	Err   error
+}
+
+// ChunkStream divide el texto que lee de r y envía los chunks por el canal a
+// medida que se completan, con las mismas estrategias que ChunkByMaxChunkSize,
+// ChunkBySentences y ChunkByParagraphs. Solo se guarda en memoria el texto que
+// aún no forma un chunk completo, así que sirve para archivos de cualquier
+// tamaño: las oraciones y párrafos que superan el tamaño máximo se cortan por
+// el último espacio. Las oraciones se detectan por su puntuación final, como en
+// ChunkSemantically, porque prose necesita el texto completo. Start y End son
+// posiciones en bytes desde el principio de r. El canal se cierra al terminar
+// el texto, si falla la lectura o si se cancela ctx.
+func ChunkStream(ctx context.Context, r io.Reader, config StreamChunkConfig) <-chan ChunkEvent {
+	events := make(chan ChunkEvent)
+
+	go func() {
+		defer close(events)
+
+		if config.Strategy == StreamByMaxChunkSize && config.MaxChunkSize <= 0 {
+			sendChunkEvent(ctx, events, ChunkEvent{Err: fmt.Errorf("MaxChunkSize debe ser mayor que cero")})
+			return
+		}
+		if config.ReadSize <= 0 {
+			config.ReadSize = DefaultStreamReadSize
+		}
+		splitter := streamSplitter{config: config, limit: config.MaxChunkSize}
+		if splitter.limit <= 0 {
+			splitter.limit = DefaultStreamMaxUnitSize
+		}
+
+		buf := make([]byte, config.ReadSize)
+		var pending []byte
+		offset := 0
+		for eof := false; !eof; {
+			if ctx.Err() != nil {
+				return
+			}
+
+			n, err := r.Read(buf)
+			pending = append(pending, buf[:n]...)
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				sendChunkEvent(ctx, events, ChunkEvent{Err: fmt.Errorf("error al leer el texto: %w", err)})
+				return
+			}
+			if n == 0 && !eof {
+				continue
+			}
+
+			text := string(pending)
+			spans, consumed := splitter.split(text, eof)
+			for _, s := range spans {
+				chunk := createChunkInfoAt(text, s.start, s.end)
+				// Se copia el texto para no retener el buffer entero mientras se usa el chunk
+				chunk.Text = strings.Clone(chunk.Text)
+				chunk.Start += offset
+				chunk.End += offset
+				if !sendChunkEvent(ctx, events, ChunkEvent{Chunk: chunk}) {
+					return
+				}
+			}
+			pending = append(pending[:0], pending[consumed:]...)
+			offset += consumed
+		}
+	}()
+
+	return events
+}
+
+func sendChunkEvent(ctx context.Context, events chan<- ChunkEvent, event ChunkEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// streamSplitter busca los chunks completos del texto pendiente. split
+// devuelve sus posiciones y cuántos bytes del principio ya no hacen falta; el
+// resto se vuelve a analizar junto con la siguiente lectura.
+type streamSplitter struct {
+	config StreamChunkConfig
+	limit  int
+}
+
+func (s *streamSplitter) split(text string, eof bool) ([]span, int) {
+	switch s.config.Strategy {
+	case StreamBySentences:
+		return s.units(text, eof, sentenceEndRegex)
+	case StreamByParagraphs:
+		return s.units(text, eof, paragraphRegex)
+	}
+	if s.config.PreserveSentenceStructure {
+		return s.sentenceGroups(text, eof)
+	}
+	return s.fixed(text, eof)
+}
+
+// fixed corta bloques de MaxChunkSize bytes sin partir ningún carácter
+func (s *streamSplitter) fixed(text string, eof bool) ([]span, int) {
+	var spans []span
+	start := 0
+	for len(text)-start > s.limit || (eof && start < len(text)) {
+		end := min(start+s.limit, len(text))
+		if end < len(text) {
+			end = runeBoundary(text, start, end)
+		}
+		spans = append(spans, span{start, end})
+		start = end
+	}
+	return spans, start
+}
+
+// units devuelve las unidades que terminan en un separador. Los separadores
+// acaban en espacios que pueden continuar en la siguiente lectura, así que no
+// se da por terminado uno que llega al final del texto. Al final del texto el
+// resto es la última unidad.
+func (s *streamSplitter) units(text string, eof bool, separator *regexp.Regexp) ([]span, int) {
+	var spans []span
+	start := 0
+	for _, match := range separator.FindAllStringIndex(text, -1) {
+		if !eof && match[1] == len(text) {
+			break
+		}
+		spans = s.appendUnit(spans, text, span{start, match[1]})
+		start = match[1]
+	}
+
+	if eof {
+		return s.appendUnit(spans, text, span{start, len(text)}), len(text)
+	}
+	// Una unidad sin terminar que ya supera el límite se corta sin esperar al separador
+	for len(text)-start > s.limit {
+		end := limitCut(text, start, s.limit)
+		spans = s.appendUnit(spans, text, span{start, end})
+		start = end
+	}
+	return spans, start
+}
+
+// appendUnit añade la unidad sin espacios en los extremos, cortada en trozos
+// que no superan el límite
+func (s *streamSplitter) appendUnit(spans []span, text string, unit span) []span {
+	for unit.end-unit.start > s.limit {
+		end := limitCut(text, unit.start, s.limit)
+		spans = s.appendUnit(spans, text, span{unit.start, end})
+		unit.start = end
+	}
+	if unit = trimSpan(text, unit); unit.end > unit.start {
+		spans = append(spans, unit)
+	}
+	return spans
+}
+
+// sentenceGroups agrupa oraciones consecutivas mientras quepan en
+// MaxChunkSize. El último grupo no se envía hasta saber que no cabe ninguna
+// oración más o hasta el final del texto.
+func (s *streamSplitter) sentenceGroups(text string, eof bool) ([]span, int) {
+	sentences, consumed := s.units(text, eof, sentenceEndRegex)
+
+	var groups []span
+	var group span
+	open := false
+	for _, sentence := range sentences {
+		if open && sentence.end-group.start > s.limit {
+			groups = append(groups, group)
+			open = false
+		}
+		if !open {
+			group = sentence
+			open = true
+			continue
+		}
+		group.end = sentence.end
+	}
+
+	if open {
+		if eof {
+			return append(groups, group), consumed
+		}
+		return groups, group.start
+	}
+	return groups, consumed
+}
+
+// limitCut devuelve dónde cortar una unidad que empieza en start para que no
+// supere limit bytes: tras el último espacio o, si no hay, en el último
+// carácter completo
+func limitCut(text string, start, limit int) int {
+	end := start + limit
+	if i := strings.LastIndexFunc(text[start:end], unicode.IsSpace); i > 0 {
+		return start + i
+	}
+	return runeBoundary(text, start, end)
+}
+
+// runeBoundary retrocede end hasta el inicio de un carácter, sin llegar a start
+func runeBoundary(text string, start, end int) int {
+	cut := end
+	for cut > start && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if cut == start {
+		return end
+	}
+	return cut
+}
@@ -0,0 +1,128 @@
+package chunker
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
+
+// collectStream devuelve el texto de los chunks de ChunkStream comprobando sus posiciones
+func collectStream(t *testing.T, text string, r io.Reader, config StreamChunkConfig) []string {
+	t.Helper()
+	var texts []string
+	for event := range ChunkStream(context.Background(), r, config) {
+		if event.Err != nil {
+			t.Fatal(event.Err)
+		}
+		chunk := event.Chunk
+		if text[chunk.Start:chunk.End] != chunk.Text {
+			t.Errorf("posiciones [%d:%d] incorrectas para %q", chunk.Start, chunk.End, chunk.Text)
+		}
+		if !utf8.ValidString(chunk.Text) {
+			t.Errorf("el chunk %q corta un carácter", chunk.Text)
+		}
+		texts = append(texts, chunk.Text)
+	}
+	return texts
+}
+
+func TestChunkStream(t *testing.T) {
+	text := "El año empezó bien. ¿Llovió?  Sí, mucho!\n\nSegundo párrafo con ñandúes.\n \nTercero"
+
+	cases := []struct {
+		name   string
+		config StreamChunkConfig
+		want   []string
+	}{
+		{
+			name:   "tamaño fijo",
+			config: StreamChunkConfig{Strategy: StreamByMaxChunkSize, MaxChunkSize: 16},
+			want:   []string{"El año empezó ", "bien. ¿Llovió?", "  Sí, mucho!\n\nS", "egundo párrafo ", "con ñandúes.\n ", "\nTercero"},
+		},
+		{
+			name:   "grupos de oraciones",
+			config: StreamChunkConfig{Strategy: StreamByMaxChunkSize, MaxChunkSize: 30, PreserveSentenceStructure: true},
+			want:   []string{"El año empezó bien.", "¿Llovió?  Sí, mucho!", "Segundo párrafo con", "ñandúes.\n \nTercero"},
+		},
+		{
+			name:   "oraciones",
+			config: StreamChunkConfig{Strategy: StreamBySentences},
+			want:   []string{"El año empezó bien.", "¿Llovió?", "Sí, mucho!", "Segundo párrafo con ñandúes.", "Tercero"},
+		},
+		{
+			name:   "oraciones con límite",
+			config: StreamChunkConfig{Strategy: StreamBySentences, MaxChunkSize: 12},
+			want:   []string{"El año", "empezó", "bien.", "¿Llovió?", "Sí, mucho!", "Segundo", "párrafo", "con", "ñandúes.", "Tercero"},
+		},
+		{
+			name:   "párrafos",
+			config: StreamChunkConfig{Strategy: StreamByParagraphs},
+			want:   []string{"El año empezó bien. ¿Llovió?  Sí, mucho!", "Segundo párrafo con ñandúes.", "Tercero"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Leer byte a byte parte los caracteres multibyte y los separadores
+			// entre lecturas; el resultado debe ser el mismo que leyendo todo de golpe
+			oneByte := collectStream(t, text, iotest.OneByteReader(strings.NewReader(text)), tc.config)
+			if !reflect.DeepEqual(oneByte, tc.want) {
+				t.Errorf("leyendo byte a byte: chunks %q, se esperaba %q", oneByte, tc.want)
+			}
+			whole := collectStream(t, text, strings.NewReader(text), tc.config)
+			if !reflect.DeepEqual(whole, tc.want) {
+				t.Errorf("leyendo de golpe: chunks %q, se esperaba %q", whole, tc.want)
+			}
+		})
+	}
+}
+
+// countingReader genera size bytes sin espacios ni puntuación y cuenta los leídos
+type countingReader struct {
+	size int64
+	read atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	remaining := r.size - r.read.Load()
+	if remaining <= 0 {
+		return 0, io.EOF
+	}
+	n := min(int64(len(p)), remaining)
+	for i := range p[:n] {
+		p[i] = 'a'
+	}
+	r.read.Add(n)
+	return int(n), nil
+}
+
+func TestChunkStreamBoundsMemoryWithoutSeparators(t *testing.T) {
+	const limit, readSize = 100, 64
+	for _, strategy := range []StreamStrategy{StreamBySentences, StreamByParagraphs} {
+		r := &countingReader{size: 1 << 20}
+		config := StreamChunkConfig{Strategy: strategy, MaxChunkSize: limit, ReadSize: readSize}
+
+		chunks := 0
+		for event := range ChunkStream(context.Background(), r, config) {
+			if event.Err != nil {
+				t.Fatal(event.Err)
+			}
+			// Mientras se envía el chunk, lo pendiente es lo leído tras su final
+			if pending := r.read.Load() - int64(event.Chunk.End); pending > limit+readSize {
+				t.Fatalf("estrategia %d: hay %d bytes pendientes, se esperaban como mucho %d", strategy, pending, limit+readSize)
+			}
+			if len(event.Chunk.Text) > limit {
+				t.Fatalf("estrategia %d: el chunk tiene %d bytes", strategy, len(event.Chunk.Text))
+			}
+			chunks++
+		}
+		if want := (1<<20 + limit - 1) / limit; chunks != want {
+			t.Errorf("estrategia %d: %d chunks, se esperaban %d", strategy, chunks, want)
+		}
+	}
+}
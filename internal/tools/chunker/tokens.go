@@ -0,0 +1,148 @@
+package chunker
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenCounter cuenta los tokens de un texto, por ejemplo con el método Count
+// de un tokenizer.Encoding
+type TokenCounter func(text string) int
+
+// EstimateTokens es el TokenCounter por defecto: aproxima un token por cada cuatro caracteres
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// OverlapUnit indica en qué se mide el solapamiento entre chunks consecutivos
+type OverlapUnit int
+
+const (
+	// OverlapTokens repite al principio de cada chunk hasta Overlap tokens del anterior
+	OverlapTokens OverlapUnit = iota
+	// OverlapSentences repite al principio de cada chunk las últimas Overlap oraciones del anterior
+	OverlapSentences
+)
+
+// TokenChunkConfig configura ChunkByTokens. MaxTokens es el presupuesto de
+// cada chunk y CountTokens el contador que se usa (EstimateTokens si es nil).
+// El solapamiento nunca impide avanzar: si no cabe junto a la palabra
+// siguiente se reduce.
+type TokenChunkConfig struct {
+	MaxTokens   int
+	Overlap     int
+	OverlapUnit OverlapUnit
+	CountTokens TokenCounter
+}
+
+// wordSpan es una palabra del texto. tokens cuenta también los espacios que la
+// preceden, ya que los tokenizadores BPE los unen a la palabra siguiente.
+type wordSpan struct {
+	start, end    int
+	tokens        int
+	sentenceStart bool
+}
+
+// ChunkByTokens divide el texto en chunks de como máximo MaxTokens tokens sin
+// cortar nunca una palabra ni un carácter multibyte. Una palabra que por sí
+// sola supera el presupuesto forma su propio chunk. Cada ChunkInfo guarda sus
+// posiciones en el texto original.
+func ChunkByTokens(text string, config TokenChunkConfig) TextChunks {
+	count := config.CountTokens
+	if count == nil {
+		count = EstimateTokens
+	}
+	words := splitWordSpans(text, count)
+
+	var chunks []ChunkInfo
+	for i := 0; i < len(words); {
+		j, total := i, 0
+		for j < len(words) && (j == i || config.MaxTokens <= 0 || total+words[j].tokens <= config.MaxTokens) {
+			total += words[j].tokens
+			j++
+		}
+		chunks = append(chunks, createChunkInfoAt(text, words[i].start, words[j-1].end))
+		if j == len(words) {
+			break
+		}
+		i = overlapStart(words, i, j, config)
+	}
+
+	return TextChunks{
+		NumChunks: len(chunks),
+		ChunkList: chunks,
+	}
+}
+
+// overlapStart devuelve la primera palabra del chunk que sigue al formado por
+// words[i:j], retrocediendo desde j según el solapamiento configurado
+func overlapStart(words []wordSpan, i, j int, config TokenChunkConfig) int {
+	if config.Overlap <= 0 {
+		return j
+	}
+	fits := func(k int) bool {
+		total := words[j].tokens
+		for _, word := range words[k:j] {
+			total += word.tokens
+		}
+		return config.MaxTokens <= 0 || total <= config.MaxTokens
+	}
+
+	if config.OverlapUnit == OverlapSentences {
+		start, sentences := j, 0
+		for k := j - 1; k > i && sentences < config.Overlap; k-- {
+			if !words[k].sentenceStart {
+				continue
+			}
+			if !fits(k) {
+				break
+			}
+			start = k
+			sentences++
+		}
+		return start
+	}
+
+	k, total := j, 0
+	for k-1 > i && total+words[k-1].tokens <= config.Overlap && fits(k-1) {
+		k--
+		total += words[k].tokens
+	}
+	return k
+}
+
+// splitWordSpans localiza las palabras del texto y cuenta sus tokens. Una
+// palabra empieza oración si la anterior termina en punto, exclamación o interrogación.
+func splitWordSpans(text string, count TokenCounter) []wordSpan {
+	var words []wordSpan
+	prevEnd := 0
+	for pos := 0; pos < len(text); {
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		if unicode.IsSpace(r) {
+			pos += size
+			continue
+		}
+
+		start := pos
+		for pos < len(text) {
+			r, size := utf8.DecodeRuneInString(text[pos:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			pos += size
+		}
+
+		word := wordSpan{start: start, end: pos, tokens: count(text[prevEnd:pos])}
+		if len(words) == 0 {
+			word.sentenceStart = true
+		} else {
+			prev := words[len(words)-1]
+			prevText := strings.TrimRight(text[prev.start:prev.end], `"')]»”`)
+			word.sentenceStart = prevText != "" && strings.LastIndexAny(prevText, ".!?") == len(prevText)-1
+		}
+		words = append(words, word)
+		prevEnd = pos
+	}
+	return words
+}
@@ -0,0 +1,82 @@
+package chunker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countWords cuenta un token por palabra para que los casos sean fáciles de seguir
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestChunkByTokens(t *testing.T) {
+	text := "Uno dos  tres.\nCuatro cinco. Seis siete ocho."
+
+	cases := []struct {
+		name   string
+		config TokenChunkConfig
+		want   []string
+	}{
+		{
+			name:   "sin solapamiento",
+			config: TokenChunkConfig{MaxTokens: 3},
+			want:   []string{"Uno dos  tres.", "Cuatro cinco. Seis", "siete ocho."},
+		},
+		{
+			name:   "solapamiento en tokens",
+			config: TokenChunkConfig{MaxTokens: 3, Overlap: 1},
+			want:   []string{"Uno dos  tres.", "tres.\nCuatro cinco.", "cinco. Seis siete", "siete ocho."},
+		},
+		{
+			name:   "solapamiento mayor que el presupuesto",
+			config: TokenChunkConfig{MaxTokens: 2, Overlap: 5},
+			want:   []string{"Uno dos", "dos  tres.", "tres.\nCuatro", "Cuatro cinco.", "cinco. Seis", "Seis siete", "siete ocho."},
+		},
+		{
+			name:   "solapamiento en oraciones",
+			config: TokenChunkConfig{MaxTokens: 4, Overlap: 1, OverlapUnit: OverlapSentences},
+			want:   []string{"Uno dos  tres.\nCuatro", "Cuatro cinco. Seis siete", "Seis siete ocho."},
+		},
+		{
+			name:   "sin límite",
+			config: TokenChunkConfig{},
+			want:   []string{text},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.CountTokens = countWords
+			chunks := ChunkByTokens(text, tc.config)
+
+			var got []string
+			for _, chunk := range chunks.ChunkList {
+				if text[chunk.Start:chunk.End] != chunk.Text {
+					t.Errorf("posiciones [%d:%d] incorrectas para %q", chunk.Start, chunk.End, chunk.Text)
+				}
+				got = append(got, chunk.Text)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("chunks %q, se esperaba %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChunkByTokensKeepsRunesWhole(t *testing.T) {
+	text := "añoñañoñaño ñandú"
+
+	chunks := ChunkByTokens(text, TokenChunkConfig{MaxTokens: 1})
+
+	want := []string{"añoñañoñaño", "ñandú"}
+	if chunks.NumChunks != len(want) {
+		t.Fatalf("se esperaban %d chunks, hay %d: %+v", len(want), chunks.NumChunks, chunks.ChunkList)
+	}
+	for i, chunk := range chunks.ChunkList {
+		if chunk.Text != want[i] || text[chunk.Start:chunk.End] != chunk.Text {
+			t.Errorf("chunk %d: %q [%d:%d], se esperaba %q", i, chunk.Text, chunk.Start, chunk.End, want[i])
+		}
+	}
+}
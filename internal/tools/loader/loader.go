@@ -13,7 +13,9 @@ import (
 	"github.com/unidoc/unioffice/document"
 )
 
-// TextDocument representa un documento de texto cargado
+// TextDocument representa un documento de texto cargado. En los PDF,
+// PageOffsets contiene la posición en bytes de Content en la que empieza cada
+// página, de modo que se puede saber de qué página procede un fragmento.
 type TextDocument struct {
 	FileSize       int64
 	WordCount      int
@@ -21,6 +23,20 @@ type TextDocument struct {
 	Content        string
 	Title          string
 	URLOrPath      string
+	PageOffsets    []int
+}
+
+// PageAt devuelve el número de página, empezando en 1, de la posición en bytes
+// indicada, o 0 si el documento no tiene páginas
+func (d *TextDocument) PageAt(offset int) int {
+	page := 0
+	for i, start := range d.PageOffsets {
+		if start > offset {
+			break
+		}
+		page = i + 1
+	}
+	return page
 }
 
 // LoadContent carga contenido de una ruta de archivo o URL dada
@@ -113,8 +129,10 @@ func readPDFFile(filePath string) (*TextDocument, error) {
 
 	var content strings.Builder
 	totalPage := r.NumPage()
+	pageOffsets := make([]int, 0, totalPage)
 
 	for pageIndex := 1; pageIndex <= totalPage; pageIndex++ {
+		pageOffsets = append(pageOffsets, content.Len())
 		p := r.Page(pageIndex)
 		if p.V.IsNull() {
 			continue
@@ -138,6 +156,7 @@ func readPDFFile(filePath string) (*TextDocument, error) {
 		CharacterCount: len(text),
 		Content:        text,
 		URLOrPath:      filePath,
+		PageOffsets:    pageOffsets,
 	}, nil
 }
 
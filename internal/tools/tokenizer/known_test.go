@@ -0,0 +1,71 @@
+//go:build integration
+
+// Los vocabularios reales no se incluyen en el repositorio, así que este test
+// solo se compila con la etiqueta integration y necesita las rutas a
+// cl100k_base.tiktoken y o200k_base.tiktoken en TIKTOKEN_CL100K_BASE y
+// TIKTOKEN_O200K_BASE:
+//
+//	go test -tags integration ./internal/tools/tokenizer
+
+package tokenizer
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// knownEncodings son textos con sus tokens en cl100k_base y o200k_base, tal y
+// como los devuelve tiktoken
+var knownEncodings = map[string][]struct {
+	text   string
+	tokens []int
+}{
+	CL100kBase: {
+		{"hello world", []int{15339, 1917}},
+		{"Hello, world!", []int{9906, 11, 1917, 0}},
+		{"tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{"2 + 2 = 4", []int{17, 489, 220, 17, 284, 220, 19}},
+		{"antidisestablishmentarianism", []int{519, 85342, 34500, 479, 8997, 2191}},
+	},
+	O200kBase: {
+		{"hello world", []int{24912, 2375}},
+		{"Hello, world!", []int{13225, 11, 2375, 0}},
+		{"tiktoken is great!", []int{83, 8251, 2488, 382, 2212, 0}},
+		{"2 + 2 = 4", []int{17, 659, 220, 17, 314, 220, 19}},
+		{"antidisestablishmentarianism", []int{493, 129901, 376, 160388, 21203, 2367}},
+	},
+}
+
+// TestKnownEncodings compara con tiktoken usando los vocabularios reales
+func TestKnownEncodings(t *testing.T) {
+	paths := map[string]string{
+		CL100kBase: os.Getenv("TIKTOKEN_CL100K_BASE"),
+		O200kBase:  os.Getenv("TIKTOKEN_O200K_BASE"),
+	}
+
+	for name, cases := range knownEncodings {
+		t.Run(name, func(t *testing.T) {
+			if paths[name] == "" {
+				t.Fatalf("falta la ruta al vocabulario de %s", name)
+			}
+			enc, err := Load(name, paths[name])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tc := range cases {
+				tokens := enc.Encode(tc.text)
+				if !reflect.DeepEqual(tokens, tc.tokens) {
+					t.Errorf("Encode(%q) = %v, se esperaba %v", tc.text, tokens, tc.tokens)
+				}
+				if enc.Count(tc.text) != len(tc.tokens) {
+					t.Errorf("Count(%q) = %d, se esperaba %d", tc.text, enc.Count(tc.text), len(tc.tokens))
+				}
+				if text, err := enc.Decode(tokens); err != nil || text != tc.text {
+					t.Errorf("Decode(%v) = %q, %v", tokens, text, err)
+				}
+			}
+		})
+	}
+}
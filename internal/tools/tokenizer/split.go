@@ -0,0 +1,220 @@
+package tokenizer
+
+import "unicode"
+
+// splitter divide un texto en los fragmentos que se codifican por separado
+// con BPE. Go no admite las expresiones regulares de tiktoken (usan
+// lookahead y cuantificadores posesivos), así que cada esquema se implementa
+// a mano con el mismo resultado.
+type splitter func(text string) []string
+
+// splitCL100k reproduce la expresión de cl100k_base:
+//
+//	'(?i:[sdmt]|ll|ve|re)|[^\r\n\p{L}\p{N}]?+\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]++[\r\n]*|\s*[\r\n]|\s+(?!\S)|\s+
+func splitCL100k(text string) []string {
+	return splitWith(text, func(s []rune) int {
+		if n := matchContraction(s); n > 0 {
+			return n
+		}
+		if n := matchLetters(s); n > 0 {
+			return n
+		}
+		if n := matchDigits(s); n > 0 {
+			return n
+		}
+		if n := matchPunctuation(s, false); n > 0 {
+			return n
+		}
+		return matchSpaces(s)
+	})
+}
+
+// splitO200k reproduce la expresión de o200k_base:
+//
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitO200k(text string) []string {
+	return splitWith(text, func(s []rune) int {
+		if n := matchWord(s, false); n > 0 {
+			return n
+		}
+		if n := matchWord(s, true); n > 0 {
+			return n
+		}
+		if n := matchDigits(s); n > 0 {
+			return n
+		}
+		if n := matchPunctuation(s, true); n > 0 {
+			return n
+		}
+		return matchSpaces(s)
+	})
+}
+
+// splitWith aplica match repetidamente; match devuelve cuántas runas ocupa el
+// siguiente fragmento
+func splitWith(text string, match func(s []rune) int) []string {
+	runes := []rune(text)
+	var pieces []string
+	for len(runes) > 0 {
+		n := match(runes)
+		if n <= 0 {
+			n = 1
+		}
+		pieces = append(pieces, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return pieces
+}
+
+// matchContraction reconoce 's, 't, 're, 've, 'm, 'll y 'd sin distinguir mayúsculas
+func matchContraction(s []rune) int {
+	if len(s) < 2 || s[0] != '\'' {
+		return 0
+	}
+	switch unicode.ToLower(s[1]) {
+	case 's', 'd', 'm', 't':
+		return 2
+	}
+	if len(s) < 3 {
+		return 0
+	}
+	switch string([]rune{unicode.ToLower(s[1]), unicode.ToLower(s[2])}) {
+	case "ll", "ve", "re":
+		return 3
+	}
+	return 0
+}
+
+// matchLetters reconoce [^\r\n\p{L}\p{N}]?+\p{L}+
+func matchLetters(s []rune) int {
+	i := 0
+	if isPrefix(s[0]) {
+		i = 1
+	}
+	j := i
+	for j < len(s) && unicode.IsLetter(s[j]) {
+		j++
+	}
+	if j == i {
+		return 0
+	}
+	return j
+}
+
+// matchWord reconoce las dos primeras alternativas de o200k: una palabra en
+// minúsculas con mayúsculas opcionales delante (upper false) o una palabra
+// que empieza en mayúsculas (upper true), seguidas de una contracción opcional
+func matchWord(s []rune, upper bool) int {
+	n := matchWordBody(s, upper)
+	if n == 0 {
+		return 0
+	}
+	return n + matchContraction(s[n:])
+}
+
+// matchWordBody prueba primero con el prefijo opcional y después sin él, ya
+// que en o200k el prefijo no es posesivo
+func matchWordBody(s []rune, upper bool) int {
+	for _, start := range []int{1, 0} {
+		if start == 1 && !isPrefix(s[0]) {
+			continue
+		}
+
+		j := start
+		for j < len(s) && isUpperClass(s[j]) {
+			j++
+		}
+		if upper {
+			if j == start {
+				continue
+			}
+			for j < len(s) && isLowerClass(s[j]) {
+				j++
+			}
+			return j
+		}
+
+		k := j
+		for k < len(s) && isLowerClass(s[k]) {
+			k++
+		}
+		if k > j {
+			return k
+		}
+		// [\p{Lu}...]* cede runas hasta que [\p{Ll}...]+ encuentra una
+		for p := j - 1; p >= start; p-- {
+			if isLowerClass(s[p]) {
+				return p + 1
+			}
+		}
+	}
+	return 0
+}
+
+// matchDigits reconoce \p{N}{1,3}
+func matchDigits(s []rune) int {
+	i := 0
+	for i < len(s) && i < 3 && unicode.IsNumber(s[i]) {
+		i++
+	}
+	return i
+}
+
+// matchPunctuation reconoce " ?[^\s\p{L}\p{N}]+[\r\n]*", admitiendo también
+// "/" al final en o200k
+func matchPunctuation(s []rune, slash bool) int {
+	i := 0
+	if s[0] == ' ' {
+		i = 1
+	}
+	j := i
+	for j < len(s) && !unicode.IsSpace(s[j]) && !unicode.IsLetter(s[j]) && !unicode.IsNumber(s[j]) {
+		j++
+	}
+	if j == i {
+		return 0
+	}
+	for j < len(s) && (s[j] == '\r' || s[j] == '\n' || (slash && s[j] == '/')) {
+		j++
+	}
+	return j
+}
+
+// matchSpaces reconoce \s*[\r\n]+, \s+(?!\S) y \s+ en ese orden
+func matchSpaces(s []rune) int {
+	run := 0
+	for run < len(s) && unicode.IsSpace(s[run]) {
+		run++
+	}
+	if run == 0 {
+		return 0
+	}
+
+	for i := run - 1; i >= 0; i-- {
+		if s[i] == '\r' || s[i] == '\n' {
+			return i + 1
+		}
+	}
+	// El último espacio se deja para el fragmento siguiente salvo al final del texto
+	if run == len(s) || run == 1 {
+		return run
+	}
+	return run - 1
+}
+
+// isPrefix indica si la runa puede preceder a una palabra: [^\r\n\p{L}\p{N}]
+func isPrefix(r rune) bool {
+	return r != '\r' && r != '\n' && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isUpperClass reconoce [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]
+func isUpperClass(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isLowerClass reconoce [\p{Ll}\p{Lm}\p{Lo}\p{M}]
+func isLowerClass(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
@@ -0,0 +1,68 @@
+package tokenizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// splitCases son textos cuya división es la misma en cl100k_base y o200k_base
+var splitCases = []struct {
+	name string
+	text string
+	want []string
+}{
+	{"números de tres en tres", "12345 1,000.5", []string{"123", "45", " ", "1", ",", "000", ".", "5"}},
+	{"operadores", "2 + 2 = 4", []string{"2", " +", " ", "2", " =", " ", "4"}},
+	{"letras y números", "abc123def", []string{"abc", "123", "def"}},
+	{"letras Unicode", "Ñandú über 日本語", []string{"Ñandú", " über", " 日本語"}},
+	{"varios espacios", "a   b", []string{"a", "  ", " b"}},
+	{"espacios al final", "a  ", []string{"a", "  "}},
+	{"tabuladores", "\t\tx", []string{"\t", "\tx"}},
+	{"línea en blanco", "a\n\nb", []string{"a", "\n\n", "b"}},
+	{"espacios alrededor de un salto", "a \n  b", []string{"a", " \n", " ", " b"}},
+	{"saltos de Windows", "a\r\nb", []string{"a", "\r\n", "b"}},
+	{"puntuación y saltos", "Hola !!!\nadiós", []string{"Hola", " !!!\n", "adiós"}},
+	{"puntuación al final", "x.\n\n", []string{"x", ".\n\n"}},
+	{"rutas", "path/to/file", []string{"path", "/to", "/file"}},
+}
+
+func TestSplitCL100k(t *testing.T) {
+	cases := append(splitCases, []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"contracciones", "I'm don't they'll WE'RE", []string{"I", "'m", " don", "'t", " they", "'ll", " WE", "'RE"}},
+		{"apóstrofo sin contracción", "'x'LLama", []string{"'x", "'LL", "ama"}},
+		{"mayúsculas dentro de una palabra", "HelloWorld JSONParser", []string{"HelloWorld", " JSONParser"}},
+		{"marca combinante", "cafe\u0301 ok", []string{"cafe", "\u0301", " ok"}},
+	}...)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := splitCL100k(tc.text); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("splitCL100k(%q) = %q, se esperaba %q", tc.text, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitO200k(t *testing.T) {
+	cases := append(splitCases, []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"contracciones", "I'm don't they'll WE'RE", []string{"I'm", " don't", " they'll", " WE'RE"}},
+		{"mayúsculas dentro de una palabra", "HelloWorld JSONParser", []string{"Hello", "World", " JSONParser"}},
+		{"marca combinante", "cafe\u0301 ok", []string{"cafe\u0301", " ok"}},
+	}...)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := splitO200k(tc.text); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("splitO200k(%q) = %q, se esperaba %q", tc.text, got, tc.want)
+			}
+		})
+	}
+}
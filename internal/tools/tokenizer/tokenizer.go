@@ -0,0 +1,246 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// CL100kBase es la codificación de gpt-4, gpt-3.5-turbo y text-embedding-3
+	CL100kBase = "cl100k_base"
+	// O200kBase es la codificación de gpt-4o y posteriores
+	O200kBase = "o200k_base"
+)
+
+// schemes contiene la división previa y los tokens especiales de cada codificación
+var schemes = map[string]struct {
+	split   splitter
+	special map[string]int
+}{
+	CL100kBase: {
+		split: splitCL100k,
+		special: map[string]int{
+			"<|endoftext|>":   100257,
+			"<|fim_prefix|>":  100258,
+			"<|fim_middle|>":  100259,
+			"<|fim_suffix|>":  100260,
+			"<|endofprompt|>": 100276,
+		},
+	},
+	O200kBase: {
+		split: splitO200k,
+		special: map[string]int{
+			"<|endoftext|>":   199999,
+			"<|endofprompt|>": 200018,
+		},
+	},
+}
+
+// modelEncodings asocia prefijos de nombres de modelo con su codificación
+var modelEncodings = map[string]string{
+	"gpt-4o":                 O200kBase,
+	"o1":                     O200kBase,
+	"gpt-4":                  CL100kBase,
+	"gpt-3.5-turbo":          CL100kBase,
+	"text-embedding-3":       CL100kBase,
+	"text-embedding-ada-002": CL100kBase,
+}
+
+// EncodingForModel devuelve el nombre de la codificación de un modelo de
+// OpenAI, buscando el prefijo más largo que coincida
+func EncodingForModel(model string) (string, bool) {
+	best := ""
+	for prefix := range modelEncodings {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return modelEncodings[best], true
+}
+
+// Encoding es un tokenizador BPE compatible con los archivos de vocabulario
+// de tiktoken (cl100k_base.tiktoken, o200k_base.tiktoken). Los tokens
+// especiales como <|endoftext|> se codifican como texto normal; Decode sí los
+// reconoce. Es seguro usar un Encoding desde varias goroutines.
+type Encoding struct {
+	name    string
+	split   splitter
+	ranks   map[string]int
+	decoder map[int][]byte
+}
+
+// Load carga el archivo de vocabulario de la codificación indicada (CL100kBase u O200kBase)
+func Load(name, path string) (*Encoding, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el vocabulario: %w", err)
+	}
+	defer file.Close()
+
+	return NewEncoding(name, file)
+}
+
+// NewEncoding lee un vocabulario en formato tiktoken: una línea por token con
+// sus bytes en base64 y su rango separados por un espacio
+func NewEncoding(name string, r io.Reader) (*Encoding, error) {
+	scheme, ok := schemes[name]
+	if !ok {
+		return nil, fmt.Errorf("codificación desconocida: %s", name)
+	}
+
+	enc := &Encoding{
+		name:    name,
+		split:   scheme.split,
+		ranks:   make(map[string]int),
+		decoder: make(map[int][]byte),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		token, rank, found := strings.Cut(text, " ")
+		if !found {
+			return nil, fmt.Errorf("línea %d del vocabulario no válida: %q", line, text)
+		}
+		data, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("token no válido en la línea %d del vocabulario: %w", line, err)
+		}
+		id, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("rango no válido en la línea %d del vocabulario: %w", line, err)
+		}
+
+		enc.ranks[string(data)] = id
+		enc.decoder[id] = data
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error al leer el vocabulario: %w", err)
+	}
+
+	for token, id := range scheme.special {
+		enc.decoder[id] = []byte(token)
+	}
+	return enc, nil
+}
+
+// Name devuelve el nombre de la codificación
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode convierte un texto en tokens
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range e.split(text) {
+		if id, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, id)
+			continue
+		}
+		tokens = append(tokens, e.bytePairEncode([]byte(piece))...)
+	}
+	return tokens
+}
+
+// Count devuelve el número de tokens de un texto
+func (e *Encoding) Count(text string) int {
+	return len(e.Encode(text))
+}
+
+// Decode convierte tokens en texto. El resultado puede no ser UTF-8 válido si
+// los tokens cortan un carácter multibyte.
+func (e *Encoding) Decode(tokens []int) (string, error) {
+	data, err := e.decodeBytes(tokens)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// TruncateToTokens recorta el texto para que ocupe como máximo maxTokens,
+// sin dejar caracteres multibyte a medias
+func (e *Encoding) TruncateToTokens(text string, maxTokens int) string {
+	tokens := e.Encode(text)
+	if len(tokens) <= maxTokens {
+		return text
+	}
+	if maxTokens <= 0 {
+		return ""
+	}
+
+	// Todos los tokens proceden de Encode, así que decodeBytes no puede fallar
+	data, _ := e.decodeBytes(tokens[:maxTokens])
+	return string(trimIncompleteRune(data))
+}
+
+func (e *Encoding) decodeBytes(tokens []int) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, id := range tokens {
+		data, ok := e.decoder[id]
+		if !ok {
+			return nil, fmt.Errorf("token desconocido en %s: %d", e.name, id)
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// bytePairEncode aplica BPE a un fragmento: une repetidamente el par de
+// partes adyacentes con menor rango hasta que no quede ninguno en el vocabulario
+func (e *Encoding) bytePairEncode(piece []byte) []int {
+	// parts[i] es el inicio de cada parte; el último elemento marca el final
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+
+	for len(parts) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(parts); i++ {
+			if rank, ok := e.ranks[string(piece[parts[i]:parts[i+2]])]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+
+	tokens := make([]int, 0, len(parts)-1)
+	for i := 0; i+1 < len(parts); i++ {
+		tokens = append(tokens, e.ranks[string(piece[parts[i]:parts[i+1]])])
+	}
+	return tokens
+}
+
+// trimIncompleteRune quita los bytes finales de un carácter UTF-8 incompleto
+func trimIncompleteRune(data []byte) []byte {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return data[:i]
+			}
+			break
+		}
+	}
+	return data
+}
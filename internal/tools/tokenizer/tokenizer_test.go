@@ -0,0 +1,59 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// syntheticVocab construye un vocabulario con los 256 bytes y las uniones
+// indicadas, cuyo rango es el orden en que aparecen
+func syntheticVocab(merges ...string) string {
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, merge := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(merge)), 256+i)
+	}
+	return b.String()
+}
+
+func TestBytePairEncodeMergesByRank(t *testing.T) {
+	enc, err := NewEncoding(CL100kBase, strings.NewReader(syntheticVocab("ll", "he", "hell", " w", "or")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "ll" tiene menor rango que "he", así que se une antes; después "he"+"ll"
+	tokens := enc.Encode("hello world")
+	want := []int{258, 'o', 259, 260, 'l', 'd'}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Encode = %v, se esperaba %v", tokens, want)
+	}
+
+	text, err := enc.Decode(tokens)
+	if err != nil || text != "hello world" {
+		t.Errorf("Decode = %q, %v", text, err)
+	}
+	if _, err := enc.Decode([]int{1 << 20}); err == nil {
+		t.Error("Decode debe fallar con un token desconocido")
+	}
+}
+
+func TestTruncateToTokensKeepsWholeRunes(t *testing.T) {
+	enc, err := NewEncoding(O200kBase, strings.NewReader(syntheticVocab()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sin uniones cada byte es un token: "ñ" ocupa dos
+	if got := enc.TruncateToTokens("año", 2); got != "a" {
+		t.Errorf("TruncateToTokens = %q, se esperaba %q", got, "a")
+	}
+	if got := enc.TruncateToTokens("año", 3); got != "añ" {
+		t.Errorf("TruncateToTokens = %q, se esperaba %q", got, "añ")
+	}
+}
@@ -1,8 +1,11 @@
 package vector_storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/codigogp/letsgollm/internal/llm"
+	"github.com/codigogp/letsgollm/internal/tools/chunker"
 	"github.com/google/uuid"
 	"gonum.org/v1/gonum/mat"
 	"math"
@@ -26,6 +29,7 @@ type VectorDatabase struct {
 	vectors                *mat.Dense
 	metadata               []map[string]interface{}
 	useSemanticConnections bool
+	embedder               llm.Embedder
 	mu                     sync.RWMutex
 }
 
@@ -162,6 +166,27 @@ func (vdb *VectorDatabase) AddVector(chunkText string, embedding []float64, meta
 	vdb.mu.Lock()
 	fmt.Println("Lock adquirido en AddVector")
 
+	uniqueID := uuid.New().String()
+	fmt.Printf("Generado ID único: %s\n", uniqueID)
+	vdb.appendVector(uniqueID, chunkText, embedding, metadata, normalize)
+
+	vdb.mu.Unlock()
+	fmt.Println("Lock liberado en AddVector")
+
+	if vdb.useSemanticConnections && len(vdb.metadata) > 1 {
+		fmt.Println("Actualizando conexiones semánticas...")
+		vdb.updateConnections(len(vdb.metadata) - 1)
+	} else {
+		fmt.Println("No se actualizan conexiones semánticas para el primer vector.")
+	}
+
+	fmt.Println("AddVector completado")
+	return uniqueID
+}
+
+// appendVector añade el vector y su registro al final de la base de datos.
+// Debe llamarse con el lock de escritura adquirido.
+func (vdb *VectorDatabase) appendVector(uniqueID string, chunkText string, embedding []float64, metadata map[string]interface{}, normalize bool) {
 	if normalize {
 		fmt.Println("Normalizando vector...")
 		embedding = normalizeVector(embedding)
@@ -184,9 +209,6 @@ func (vdb *VectorDatabase) AddVector(chunkText string, embedding []float64, meta
 		vdb.vectors = newVectors
 	}
 
-	uniqueID := uuid.New().String()
-	fmt.Printf("Generado ID único: %s\n", uniqueID)
-
 	record := map[string]interface{}{
 		"id":          uniqueID,
 		"chunk_text":  chunkText,
@@ -197,19 +219,272 @@ func (vdb *VectorDatabase) AddVector(chunkText string, embedding []float64, meta
 
 	vdb.metadata = append(vdb.metadata, record)
 	fmt.Printf("Metadata actualizado. Número total de registros: %d\n", len(vdb.metadata))
+}
 
-	vdb.mu.Unlock()
-	fmt.Println("Lock liberado en AddVector")
+// SetEmbedder configura el Embedder usado por AddText, AddTexts y SearchText
+func (vdb *VectorDatabase) SetEmbedder(embedder llm.Embedder) {
+	vdb.mu.Lock()
+	defer vdb.mu.Unlock()
+	vdb.embedder = embedder
+}
 
-	if vdb.useSemanticConnections && len(vdb.metadata) > 1 {
-		fmt.Println("Actualizando conexiones semánticas...")
-		vdb.updateConnections(len(vdb.metadata) - 1)
-	} else {
-		fmt.Println("No se actualizan conexiones semánticas para el primer vector.")
+// AddText genera el embedding del texto con el Embedder configurado y lo añade a la base de datos
+func (vdb *VectorDatabase) AddText(ctx context.Context, chunkText string, metadata map[string]interface{}, normalize bool) (string, error) {
+	ids, err := vdb.AddTexts(ctx, []string{chunkText}, []map[string]interface{}{metadata}, normalize)
+	if err != nil {
+		return "", err
 	}
+	return ids[0], nil
+}
 
-	fmt.Println("AddVector completado")
-	return uniqueID
+// AddTexts genera los embeddings de varios textos en una sola llamada y los añade a la base de datos.
+// metadata puede ser nil o tener un elemento por texto.
+func (vdb *VectorDatabase) AddTexts(ctx context.Context, chunkTexts []string, metadata []map[string]interface{}, normalize bool) ([]string, error) {
+	if metadata != nil && len(metadata) != len(chunkTexts) {
+		return nil, fmt.Errorf("expected %d metadata entries, got %d", len(chunkTexts), len(metadata))
+	}
+
+	embeddings, err := vdb.embed(ctx, chunkTexts)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(chunkTexts))
+	for i, text := range chunkTexts {
+		var meta map[string]interface{}
+		if metadata != nil {
+			meta = metadata[i]
+		}
+		ids[i] = vdb.AddVector(text, embeddings[i], meta, normalize)
+	}
+
+	return ids, nil
+}
+
+// AddChunks genera los embeddings de los chunks y los añade con su procedencia
+// (ChunkInfo.StoreMetadata) como metadata. El ID de cada chunk se usa como id
+// del registro, así que al reindexar un documento los chunks que no han
+// cambiado no se vuelven a procesar: solo se actualiza su metadata. Los
+// registros de los mismos orígenes (source) que ya no aparecen entre los
+// chunks se eliminan.
+func (vdb *VectorDatabase) AddChunks(ctx context.Context, chunks chunker.TextChunks, normalize bool) ([]string, error) {
+	ids := make([]string, len(chunks.ChunkList))
+	for i, chunk := range chunks.ChunkList {
+		ids[i] = chunk.ID
+		if ids[i] == "" {
+			ids[i] = uuid.New().String()
+		}
+	}
+
+	// Los embeddings se generan sin el lock. Si mientras tanto otra llamada
+	// elimina alguno de los chunks que ya estaban guardados, se genera el suyo
+	// y se vuelve a intentar.
+	embeddings := map[int][]float64{}
+	for {
+		vdb.mu.RLock()
+		missing := missingChunks(chunks.ChunkList, vdb.idIndex(), embeddings)
+		vdb.mu.RUnlock()
+		if err := vdb.embedChunks(ctx, chunks.ChunkList, missing, embeddings); err != nil {
+			return nil, err
+		}
+
+		vdb.mu.Lock()
+		existing := vdb.idIndex()
+		if len(missingChunks(chunks.ChunkList, existing, embeddings)) > 0 {
+			vdb.mu.Unlock()
+			continue
+		}
+
+		vdb.refreshChunks(chunks.ChunkList)
+		var added []string
+		for i, chunk := range chunks.ChunkList {
+			if _, ok := existing[ids[i]]; ok {
+				continue
+			}
+			vdb.appendVector(ids[i], chunk.Text, embeddings[i], chunk.StoreMetadata(), normalize)
+			existing[ids[i]] = len(vdb.metadata) - 1
+			added = append(added, ids[i])
+		}
+		vdb.mu.Unlock()
+
+		vdb.connectRecords(added)
+		return ids, nil
+	}
+}
+
+// missingChunks devuelve la posición de los chunks que no están guardados y
+// de los que aún no se tiene el embedding
+func missingChunks(chunks []chunker.ChunkInfo, existing map[string]int, embeddings map[int][]float64) []int {
+	var missing []int
+	for i, chunk := range chunks {
+		if _, ok := existing[chunk.ID]; chunk.ID != "" && ok {
+			continue
+		}
+		if _, ok := embeddings[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// embedChunks genera los embeddings de los chunks indicados y los guarda por posición
+func (vdb *VectorDatabase) embedChunks(ctx context.Context, chunks []chunker.ChunkInfo, indexes []int, embeddings map[int][]float64) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	texts := make([]string, len(indexes))
+	for i, index := range indexes {
+		texts[i] = chunks[index].Text
+	}
+	vectors, err := vdb.embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	for i, index := range indexes {
+		embeddings[index] = vectors[i]
+	}
+	return nil
+}
+
+// connectRecords actualiza las conexiones semánticas de los registros añadidos
+func (vdb *VectorDatabase) connectRecords(ids []string) {
+	if !vdb.useSemanticConnections {
+		return
+	}
+	for _, id := range ids {
+		vdb.mu.RLock()
+		index, ok := vdb.idIndex()[id]
+		rows := len(vdb.metadata)
+		vdb.mu.RUnlock()
+		if ok && rows > 1 {
+			vdb.updateConnections(index)
+		}
+	}
+}
+
+// idIndex devuelve la posición de cada registro según su id. Debe llamarse
+// con el lock adquirido.
+func (vdb *VectorDatabase) idIndex() map[string]int {
+	index := make(map[string]int, len(vdb.metadata))
+	for i, meta := range vdb.metadata {
+		if id, ok := meta["id"].(string); ok {
+			index[id] = i
+		}
+	}
+	return index
+}
+
+// refreshChunks sustituye la metadata de los chunks que ya están guardados y
+// elimina los registros de sus mismos orígenes que no están entre ellos. Debe
+// llamarse con el lock de escritura adquirido.
+func (vdb *VectorDatabase) refreshChunks(chunks []chunker.ChunkInfo) {
+	current := make(map[string]chunker.ChunkInfo, len(chunks))
+	sources := map[string]bool{}
+	for _, chunk := range chunks {
+		if chunk.ID != "" {
+			current[chunk.ID] = chunk
+		}
+		if chunk.Source != "" {
+			sources[chunk.Source] = true
+		}
+	}
+
+	stale := map[string]bool{}
+	for _, record := range vdb.metadata {
+		id, _ := record["id"].(string)
+		if chunk, ok := current[id]; ok {
+			record["metadata"] = chunk.StoreMetadata()
+			continue
+		}
+		if meta, ok := record["metadata"].(map[string]interface{}); ok {
+			if source, ok := meta["source"].(string); ok && sources[source] {
+				stale[id] = true
+			}
+		}
+	}
+	if len(stale) > 0 {
+		vdb.removeRecords(stale)
+	}
+}
+
+// removeRecords elimina los registros con los ids indicados y las conexiones
+// que apuntan a ellos. Debe llamarse con el lock de escritura adquirido.
+func (vdb *VectorDatabase) removeRecords(ids map[string]bool) {
+	var kept []int
+	for i, record := range vdb.metadata {
+		if id, _ := record["id"].(string); !ids[id] {
+			kept = append(kept, i)
+		}
+	}
+
+	metadata := make([]map[string]interface{}, 0, len(kept))
+	var vectors *mat.Dense
+	if len(kept) > 0 {
+		_, cols := vdb.vectors.Dims()
+		vectors = mat.NewDense(len(kept), cols, nil)
+	}
+	for row, i := range kept {
+		vectors.SetRow(row, vdb.vectors.RawRowView(i))
+		record := vdb.metadata[i]
+		record["connections"] = connectionsWithout(record["connections"], ids)
+		metadata = append(metadata, record)
+	}
+	vdb.vectors = vectors
+	vdb.metadata = metadata
+}
+
+// connectionsWithout quita de las conexiones de un registro las que apuntan a
+// los ids indicados. Tras cargar de JSON las conexiones son []interface{}.
+func connectionsWithout(connections interface{}, ids map[string]bool) interface{} {
+	switch conns := connections.(type) {
+	case []map[string]interface{}:
+		filtered := []map[string]interface{}{}
+		for _, conn := range conns {
+			if id, _ := conn["id"].(string); !ids[id] {
+				filtered = append(filtered, conn)
+			}
+		}
+		return filtered
+	case []interface{}:
+		filtered := []interface{}{}
+		for _, conn := range conns {
+			if connMap, ok := conn.(map[string]interface{}); ok && ids[fmt.Sprint(connMap["id"])] {
+				continue
+			}
+			filtered = append(filtered, conn)
+		}
+		return filtered
+	}
+	return connections
+}
+
+// SearchText busca los vectores más similares al embedding de la consulta
+func (vdb *VectorDatabase) SearchText(ctx context.Context, query string, topN int) ([]SimilarityResult, error) {
+	embeddings, err := vdb.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return vdb.TopCosineSimilarity(embeddings[0], topN), nil
+}
+
+func (vdb *VectorDatabase) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vdb.mu.RLock()
+	embedder := vdb.embedder
+	vdb.mu.RUnlock()
+
+	if embedder == nil {
+		return nil, fmt.Errorf("no embedder configured")
+	}
+
+	embeddings, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("error generating embeddings: %v", err)
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddings))
+	}
+
+	return embeddings, nil
 }
 
 // AddVectorsBatch añade un lote de vectores a la base de datos
@@ -0,0 +1,206 @@
+package vector_storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/codigogp/letsgollm/internal/tools/chunker"
+	"github.com/codigogp/letsgollm/internal/tools/loader"
+)
+
+// countingEmbedder devuelve un vector a partir de la longitud de cada texto y
+// guarda los textos que recibe
+type countingEmbedder struct {
+	texts []string
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	e.texts = append(e.texts, texts...)
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float64{float64(len(text)), 1}
+	}
+	return vectors, nil
+}
+
+func (e *countingEmbedder) Dimensions() int { return 2 }
+
+// barrierEmbedder es como countingEmbedder pero sin estado y espera a que
+// lleguen n llamadas antes de responder, para que todas coincidan en el tiempo
+type barrierEmbedder struct {
+	mu      sync.Mutex
+	pending int
+	ready   chan struct{}
+}
+
+func newBarrierEmbedder(n int) *barrierEmbedder {
+	return &barrierEmbedder{pending: n, ready: make(chan struct{})}
+}
+
+func (e *barrierEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	e.mu.Lock()
+	if e.pending--; e.pending == 0 {
+		close(e.ready)
+	}
+	e.mu.Unlock()
+	<-e.ready
+
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float64{float64(len(text)), 1}
+	}
+	return vectors, nil
+}
+
+func (e *barrierEmbedder) Dimensions() int { return 2 }
+
+// documentChunks divide un documento en oraciones con su procedencia
+func documentChunks(source, content string, sentences ...string) chunker.TextChunks {
+	list := make([]chunker.ChunkInfo, len(sentences))
+	for i, sentence := range sentences {
+		list[i] = chunker.ChunkInfo{Text: sentence}
+	}
+	doc := &loader.TextDocument{Content: content, URLOrPath: source}
+	return chunker.WithProvenance(chunker.TextChunks{NumChunks: len(list), ChunkList: list}, doc)
+}
+
+// records devuelve los registros guardados por id
+func records(vdb *VectorDatabase) map[string]map[string]interface{} {
+	result := map[string]map[string]interface{}{}
+	for _, record := range vdb.metadata {
+		result[record["id"].(string)] = record
+	}
+	return result
+}
+
+func TestAddChunksReindexesDocument(t *testing.T) {
+	vdb := NewVectorDatabase(t.TempDir(), false)
+	embedder := &countingEmbedder{}
+	vdb.SetEmbedder(embedder)
+	ctx := context.Background()
+
+	first := documentChunks("a.txt", "Uno. Dos. Tres.", "Uno.", "Dos.", "Tres.")
+	if _, err := vdb.AddChunks(ctx, first, false); err != nil {
+		t.Fatal(err)
+	}
+	other := documentChunks("b.txt", "Otro.", "Otro.")
+	if _, err := vdb.AddChunks(ctx, other, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Se quita "Dos." y se añade "Cero." al principio: "Uno." y "Tres." cambian de posición
+	embedder.texts = nil
+	second := documentChunks("a.txt", "Cero. Uno. Tres.", "Cero.", "Uno.", "Tres.")
+	ids, err := vdb.AddChunks(ctx, second, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(embedder.texts) != 1 || embedder.texts[0] != "Cero." {
+		t.Errorf("solo se debe generar el embedding del chunk nuevo, se generaron %q", embedder.texts)
+	}
+
+	stored := records(vdb)
+	if len(stored) != 4 || len(vdb.metadata) != 4 {
+		t.Fatalf("se esperaban 4 registros, hay %d", len(vdb.metadata))
+	}
+	if rows, _ := vdb.vectors.Dims(); rows != 4 {
+		t.Errorf("se esperaban 4 vectores, hay %d", rows)
+	}
+	if _, ok := stored[first.ChunkList[1].ID]; ok {
+		t.Error("el chunk eliminado del documento sigue guardado")
+	}
+	if _, ok := stored[other.ChunkList[0].ID]; !ok {
+		t.Error("no se deben eliminar los chunks de otros orígenes")
+	}
+
+	for i, chunk := range second.ChunkList {
+		if ids[i] != chunk.ID {
+			t.Errorf("id %d = %s, se esperaba %s", i, ids[i], chunk.ID)
+		}
+		meta := stored[chunk.ID]["metadata"].(map[string]interface{})
+		if meta["chunk_index"] != i || meta["byte_start"] != chunk.Start {
+			t.Errorf("metadata desactualizada de %q: %v", chunk.Text, meta)
+		}
+	}
+
+	// Cada vector sigue correspondiendo a su registro
+	for i, record := range vdb.metadata {
+		if got := vdb.vectors.At(i, 0); got != float64(len(record["chunk_text"].(string))) {
+			t.Errorf("el vector %d no corresponde a %q", i, record["chunk_text"])
+		}
+	}
+}
+
+func TestAddChunksRemovesConnectionsToStaleChunks(t *testing.T) {
+	vdb := NewVectorDatabase(t.TempDir(), true)
+	vdb.SetEmbedder(&countingEmbedder{})
+	ctx := context.Background()
+
+	first := documentChunks("a.txt", "Uno. Dos. Tres.", "Uno.", "Dos.", "Tres.")
+	if _, err := vdb.AddChunks(ctx, first, false); err != nil {
+		t.Fatal(err)
+	}
+	removed := first.ChunkList[1].ID
+	if !connectedTo(vdb, removed) {
+		t.Fatal("ningún chunk está conectado al que se va a eliminar")
+	}
+
+	second := documentChunks("a.txt", "Uno. Tres.", "Uno.", "Tres.")
+	if _, err := vdb.AddChunks(ctx, second, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if connectedTo(vdb, removed) {
+		t.Error("quedan conexiones al chunk eliminado")
+	}
+	if len(vdb.metadata) != 2 {
+		t.Errorf("se esperaban 2 registros, hay %d", len(vdb.metadata))
+	}
+}
+
+// connectedTo indica si algún registro tiene una conexión con el id indicado
+func connectedTo(vdb *VectorDatabase, id string) bool {
+	for _, record := range vdb.metadata {
+		connections, _ := record["connections"].([]map[string]interface{})
+		for _, conn := range connections {
+			if conn["id"] == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestAddChunksConcurrentReindex(t *testing.T) {
+	vdb := NewVectorDatabase(t.TempDir(), false)
+	vdb.SetEmbedder(newBarrierEmbedder(8))
+	ctx := context.Background()
+
+	// Todas las llamadas generan sus embeddings antes de que ninguna guarde nada
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := vdb.AddChunks(ctx, documentChunks("a.txt", "Uno. Dos. Tres.", "Uno.", "Dos.", "Tres."), false)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(vdb.metadata) != 3 || len(records(vdb)) != 3 {
+		t.Errorf("se esperaban 3 registros sin duplicados, hay %d", len(vdb.metadata))
+	}
+	if rows, _ := vdb.vectors.Dims(); rows != 3 {
+		t.Errorf("se esperaban 3 vectores, hay %d", rows)
+	}
+}